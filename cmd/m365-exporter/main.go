@@ -9,9 +9,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/cloudeteer/m365-exporter/pkg/auth"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/adsync"
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/application"
@@ -27,6 +29,7 @@ import (
 	"github.com/cloudeteer/m365-exporter/pkg/conf"
 	"github.com/cloudeteer/m365-exporter/pkg/health"
 	"github.com/cloudeteer/m365-exporter/pkg/httpclient"
+	"github.com/cloudeteer/m365-exporter/pkg/inventory"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
@@ -73,11 +76,90 @@ func run(logWriter io.Writer) int {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
+	env, err := cloud.Lookup(v.GetString(conf.KeyAzureCloud))
+	if err != nil {
+		logger.ErrorContext(ctx, "unable to determine azure cloud", slog.Any("err", err))
+
+		return 1
+	}
+
+	logger.InfoContext(ctx, "using azure cloud "+env.Name)
+
 	reg := prometheus.NewRegistry()
 
-	httpClient := httpclient.New(reg)
+	transport, err := httpclient.NewTransport(httpclient.TransportSettings{
+		ProxyURL:              v.GetString(conf.KeyHTTPProxyURL),
+		ProxyPasswordFile:     v.GetString(conf.KeyHTTPProxyPasswordFile),
+		NoProxy:               v.GetString(conf.KeyHTTPNoProxy),
+		CAFile:                v.GetString(conf.KeyHTTPCAFile),
+		MaxIdleConns:          v.GetInt(conf.KeyHTTPMaxIdleConns),
+		MaxIdleConnsPerHost:   v.GetInt(conf.KeyHTTPMaxIdleConnsPerHost),
+		IdleConnTimeout:       time.Duration(v.GetInt(conf.KeyHTTPIdleConnTimeout)) * time.Second,
+		TLSHandshakeTimeout:   time.Duration(v.GetInt(conf.KeyHTTPTLSHandshakeTimeout)) * time.Second,
+		ResponseHeaderTimeout: time.Duration(v.GetInt(conf.KeyHTTPResponseHeaderTimeout)) * time.Second,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "unable to configure http transport", slog.Any("err", err))
+
+		return 1
+	}
+
+	roundTripper, err := recordOrReplay(ctx, logger, transport)
+	if err != nil {
+		logger.ErrorContext(ctx, "unable to configure http recording", slog.Any("err", err))
+
+		return 1
+	}
+
+	httpClient := httpclient.New(reg, httpclient.Settings{
+		Transport: roundTripper,
+		Limits: httpclient.Limits{
+			Global: v.GetInt(conf.KeyHTTPMaxConcurrentRequests),
+			PerHost: map[string]int{
+				env.GraphHost():                  v.GetInt(conf.KeyHTTPGraphMaxConcurrent),
+				env.ARMHost():                    v.GetInt(conf.KeyHTTPARMMaxConcurrent),
+				env.ExchangeHost():               v.GetInt(conf.KeyHTTPExchangeMaxConcurrent),
+				env.SharePointAdminHostPattern(): v.GetInt(conf.KeyHTTPSharePointMaxConcurrent),
+			},
+			RequestsPerSecond: v.GetFloat64(conf.KeyHTTPRequestsPerSecond),
+			Burst:             v.GetInt(conf.KeyHTTPRequestsPerSecondBurst),
+		},
+	})
+
+	tenantID := v.GetString(conf.KeyAzureTenantID)
+
+	authSettings := auth.Settings{
+		Method:                  v.GetString(conf.KeyAzureAuthMethod),
+		TenantID:                tenantID,
+		ClientID:                v.GetString(conf.KeyAzureAuthClientID),
+		ClientSecret:            v.GetString(conf.KeyAzureAuthClientSecret),
+		ClientSecretFile:        v.GetString(conf.KeyAzureAuthClientSecretFile),
+		CertificatePath:         v.GetString(conf.KeyAzureAuthCertificatePath),
+		CertificatePasswordFile: v.GetString(conf.KeyAzureAuthCertificatePasswordFile),
+		FederatedTokenFile:      v.GetString(conf.KeyAzureAuthFederatedTokenFile),
+	}
+
+	logger.InfoContext(ctx, "using authentication method "+authSettings.Method,
+		slog.String("client_id", authSettings.ClientID),
+	)
+
+	// replayed responses don't need a token
+	azureCredential := auth.NewStaticCredential("replay")
+	if v.GetString(conf.KeyHTTPReplayDir) == "" {
+		azureCredential, err = auth.NewCredential(authSettings, env, httpClient.GetHTTPClient())
+	}
+
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to create azure credential",
+			slog.Any("error", err),
+		)
+
+		return 1
+	}
+
+	azureCredential = auth.NewInstrumentedCredential(reg, azureCredential)
 
-	msGraphClient, azureCredential, err := auth.NewMSGraphClient(httpClient.GetHTTPClient())
+	msGraphClient, err := auth.NewMSGraphClientWithCredential(httpClient.GetHTTPClient(), env, azureCredential)
 	if err != nil {
 		logger.ErrorContext(ctx, "failed to authenticate against Microsoft",
 			slog.Any("error", err),
@@ -86,17 +168,29 @@ func run(logWriter io.Writer) int {
 		return 1
 	}
 
-	httpClient.WithAzureCredential(azureCredential)
+	httpClient.WithAzureCredential(azureCredential, env)
 
 	// register default collectors from github.com/prometheus/client_golang/prometheus/collectors
 	reg.MustRegister(version.NewCollector("m365_exporter"))
 	reg.MustRegister(collectors.NewBuildInfoCollector())
 	reg.MustRegister(collectors.NewGoCollector())
 	reg.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	reg.MustRegister(auth.NewInfoCollector(tenantID, authSettings))
 
-	tenantID := v.GetString(conf.KeyAzureTenantID)
+	var inventoryCache *inventory.Cache
+
+	if v.GetBool(conf.KeyInventoryEnabled) {
+		inventoryCache = inventory.NewCache(logger, tenantID, msGraphClient, inventory.Settings{
+			MinSyncInterval:  time.Duration(v.GetInt(conf.KeyInventoryMinSyncInterval)) * time.Minute,
+			FullSyncInterval: time.Duration(v.GetInt(conf.KeyInventoryFullSyncInterval)) * time.Minute,
+		})
+
+		reg.MustRegister(inventoryCache)
+	}
 
-	err = setupMetricsCollectors(ctx, logger, reg, tenantID, msGraphClient, httpClient.GetHTTPClient())
+	permissionChecker := auth.NewPermissionChecker(reg, azureCredential, env)
+
+	err = setupMetricsCollectors(ctx, logger, reg, tenantID, msGraphClient, httpClient.GetHTTPClient(), env, inventoryCache, permissionChecker)
 	if err != nil {
 		logger.ErrorContext(ctx, "failed to setup metrics collectors",
 			slog.Any("error", err),
@@ -164,25 +258,167 @@ func run(logWriter io.Writer) int {
 	return 0
 }
 
+// recordOrReplay wraps transport to record sanitized responses, or replaces it to replay recorded responses, if configured.
+func recordOrReplay(ctx context.Context, logger *slog.Logger, transport http.RoundTripper) (http.RoundTripper, error) {
+	sanitizer := httpclient.NewSanitizer(v.GetString(conf.KeyHTTPRecordSalt))
+
+	if dir := v.GetString(conf.KeyHTTPReplayDir); dir != "" {
+		logger.WarnContext(ctx, "replaying recorded responses from "+dir+", no requests are sent to Microsoft")
+
+		replay, err := httpclient.NewReplayTransport(dir, sanitizer)
+		if err != nil {
+			return nil, fmt.Errorf("error loading recordings: %w", err)
+		}
+
+		return replay, nil
+	}
+
+	if dir := v.GetString(conf.KeyHTTPRecordDir); dir != "" {
+		logger.WarnContext(ctx, "recording sanitized responses to "+dir)
+
+		recording, err := httpclient.NewRecordingTransport(transport, dir, sanitizer)
+		if err != nil {
+			return nil, fmt.Errorf("error creating recording transport: %w", err)
+		}
+
+		return recording, nil
+	}
+
+	return transport, nil
+}
+
+// checkPermissions compares the permissions required by collector with the granted ones and
+// applies the configured missing permission action. It returns whether the collector should be registered.
+func checkPermissions(ctx context.Context, logger *slog.Logger, checker *auth.PermissionChecker, collector abstract.Collector) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	name := collector.GetSubsystem()
+
+	missing, err := checker.Missing(ctx, name, collector.RequiredPermissions())
+	if err != nil {
+		// the token may be unavailable at startup, the collector reports errors on scrape
+		logger.WarnContext(ctx, "unable to verify collector permissions",
+			slog.String("collector", name),
+			slog.Any("err", err),
+		)
+	}
+
+	permissions := make([]string, 0, len(missing))
+	optional := make([]string, 0, len(missing))
+
+	for _, permission := range missing {
+		if permission.Optional {
+			optional = append(optional, permission.Name)
+		} else {
+			permissions = append(permissions, permission.Name)
+		}
+	}
+
+	// optional permissions only enable sections of the collector, they don't trigger the missing permission action
+	if len(optional) > 0 {
+		logger.WarnContext(ctx, "collector is missing optional permissions, some of its metrics are unavailable",
+			slog.String("collector", name),
+			slog.Any("missing", optional),
+		)
+	}
+
+	if len(permissions) == 0 {
+		return true, nil
+	}
+
+	switch v.GetString(conf.KeyMissingPermissionAction) {
+	case conf.MissingPermissionActionFail:
+		return false, fmt.Errorf("collector %s is missing permissions %v", name, permissions)
+	case conf.MissingPermissionActionDisable:
+		logger.WarnContext(ctx, "collector is missing permissions, skipping registration",
+			slog.String("collector", name),
+			slog.Any("missing", permissions),
+		)
+
+		return false, nil
+	default:
+		logger.WarnContext(ctx, "collector is missing permissions",
+			slog.String("collector", name),
+			slog.Any("missing", permissions),
+		)
+
+		return true, nil
+	}
+}
+
 func setupMetricsCollectors(
 	ctx context.Context, logger *slog.Logger,
 	reg *prometheus.Registry, tenantID string,
 	msGraphClient *msgraphsdk.GraphServiceClient, httpClient *http.Client,
+	env cloud.Environment, inventoryCache *inventory.Cache,
+	permissionChecker *auth.PermissionChecker,
 ) error {
+	adsyncCollector := adsync.NewCollector(logger, tenantID, msGraphClient, httpClient, env, adsync.Settings{
+		Concurrency:  v.GetInt(conf.KeyAdsSyncConcurrency),
+		ErrorDetails: v.GetBool(conf.KeyAdsSyncErrorDetails),
+	})
+
+	// the objects contain names and UPNs, they are only served with a bearer token
+	if v.GetBool(conf.KeyAdsSyncEnabled) && v.GetBool(conf.KeyAdsSyncErrorDetails) {
+		tokenFile := v.GetString(conf.KeyAdsSyncErrorDetailsTokenFile)
+		if tokenFile == "" {
+			logger.WarnContext(ctx, "not serving /adsync/errors, "+conf.KeyAdsSyncErrorDetailsTokenFile+" is not set")
+		} else {
+			content, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %w", conf.KeyAdsSyncErrorDetailsTokenFile, err)
+			}
+
+			token := strings.TrimSpace(string(content))
+			if token == "" {
+				return fmt.Errorf("%s %s is empty", conf.KeyAdsSyncErrorDetailsTokenFile, tokenFile)
+			}
+
+			http.Handle("/adsync/errors", adsyncCollector.ErrorObjectsHandler(token))
+		}
+	}
+
+	var exchangeCmdlets []exchange.CmdletMetric
+
+	err := v.UnmarshalKey(conf.KeyExchangeCmdlets, &exchangeCmdlets)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", conf.KeyExchangeCmdlets, err)
+	}
+
+	err = exchange.ValidateCmdlets(exchangeCmdlets)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", conf.KeyExchangeCmdlets, err)
+	}
+
 	for _, val := range []struct {
 		collector abstract.Collector
 		interval  time.Duration
 		enabled   bool
 	}{
 		{
-			collector: adsync.NewCollector(logger, tenantID, msGraphClient, httpClient),
+			collector: adsyncCollector,
 			interval:  1 * time.Hour,
 			enabled:   v.GetBool(conf.KeyAdsSyncEnabled),
 		},
 		{
-			collector: exchange.NewCollector(logger, tenantID, httpClient),
-			interval:  1 * time.Hour,
-			enabled:   v.GetBool(conf.KeyExchangeEnabled),
+			collector: exchange.NewCollector(logger, tenantID, msGraphClient, httpClient, env, exchange.Settings{
+				MailflowDaily:     v.GetBool(conf.KeyExchangeMailflowDaily),
+				MailflowCounter:   v.GetBool(conf.KeyExchangeMailflowCounter),
+				MailflowStateFile: v.GetString(conf.KeyExchangeMailflowStateFile),
+				MailboxUsage:      v.GetBool(conf.KeyExchangeMailboxUsage),
+				MailboxDetails:    v.GetBool(conf.KeyExchangeMailboxDetails),
+				ScrambleNames:     v.GetBool(conf.KeyExchangeScrambleNames),
+				ScrambleSalt:      v.GetString(conf.KeyODriveScrambleSalt),
+				MailSecurity:      v.GetBool(conf.KeyExchangeMailSecurity),
+				Resolver:          exchange.NewResolver(v.GetString(conf.KeyExchangeDNSServer)),
+				Quarantine:        v.GetBool(conf.KeyExchangeQuarantine),
+				ZAP:               v.GetBool(conf.KeyExchangeZAP),
+				MessageTrace:      v.GetBool(conf.KeyExchangeMessageTrace),
+				Cmdlets:           exchangeCmdlets,
+			}),
+			interval: 1 * time.Hour,
+			enabled:  v.GetBool(conf.KeyExchangeEnabled),
 		},
 		{
 			collector: securescore.NewCollector(logger, tenantID, msGraphClient),
@@ -200,7 +436,7 @@ func setupMetricsCollectors(
 			enabled:   v.GetBool(conf.KeyServiceHealthEnabled),
 		},
 		{
-			collector: intune.NewCollector(logger, tenantID, msGraphClient, httpClient),
+			collector: intune.NewCollector(logger, tenantID, msGraphClient, httpClient, env),
 			interval:  3 * time.Hour,
 			enabled:   v.GetBool(conf.KeyIntuneEnabled),
 		},
@@ -208,14 +444,18 @@ func setupMetricsCollectors(
 			collector: onedrive.NewCollector(logger, tenantID, msGraphClient, onedrive.Settings{
 				ScrambleSalt:  v.GetString(conf.KeyODriveScrambleSalt),
 				ScrambleNames: v.GetBool(conf.KeyODriveScrambleNames),
+				Concurrency:   v.GetInt(conf.KeyODriveConcurrency),
+				Inventory:     inventoryCache,
 			}),
 			interval: 3 * time.Hour,
 			enabled:  v.GetBool(conf.KeyODriveEnabled),
 		},
 		{
-			collector: teams.NewCollector(logger, tenantID, msGraphClient),
-			interval:  3 * time.Hour,
-			enabled:   v.GetBool(conf.KeyTeamsEnabled),
+			collector: teams.NewCollector(logger, tenantID, msGraphClient, teams.Settings{
+				Concurrency: v.GetInt(conf.KeyTeamsConcurrency),
+			}),
+			interval: 3 * time.Hour,
+			enabled:  v.GetBool(conf.KeyTeamsEnabled),
 		},
 		{
 			collector: entraid.NewCollector(logger, tenantID, msGraphClient),
@@ -223,7 +463,7 @@ func setupMetricsCollectors(
 			enabled:   v.GetBool(conf.KeyEntraIDEnabled),
 		},
 		{
-			collector: sharepoint.NewCollector(logger, tenantID, msGraphClient, httpClient),
+			collector: sharepoint.NewCollector(logger, tenantID, msGraphClient, httpClient, env),
 			interval:  1 * time.Hour,
 			enabled:   v.GetBool(conf.KeySharePointEnabled),
 		},
@@ -250,7 +490,16 @@ func setupMetricsCollectors(
 			continue
 		}
 
-		err := reg.Register(val.collector)
+		register, err := checkPermissions(ctx, logger, permissionChecker, val.collector)
+		if err != nil {
+			return err
+		}
+
+		if !register {
+			continue
+		}
+
+		err = reg.Register(val.collector)
 		if err != nil {
 			return fmt.Errorf("failed to register collector: %w", err)
 		}
@@ -258,5 +507,12 @@ func setupMetricsCollectors(
 		val.collector.StartBackgroundWorker(ctx, val.interval)
 	}
 
+	for resource, roles := range permissionChecker.Roles() {
+		logger.InfoContext(ctx, "granted permissions",
+			slog.String("resource", resource),
+			slog.Any("roles", roles),
+		)
+	}
+
 	return nil
 }
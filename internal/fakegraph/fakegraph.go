@@ -0,0 +1,428 @@
+// Package fakegraph provides a local server with canned responses for Microsoft Graph, Azure Resource Manager,
+// the Exchange Online admin API and the SharePoint admin API, so collectors can be tested without a tenant.
+//
+// All APIs are served from one host, their paths don't overlap: Graph is served below /v1.0 and /beta,
+// ARM below /providers, Exchange below /adminapi and SharePoint below /_api. Exchange runs all cmdlets via the same
+// InvokeCommand path, a route for one cmdlet is registered by appending its name, e.g. .../InvokeCommand/Get-AcceptedDomain.
+package fakegraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/pkg/auth"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+const skipTokenParam = "$skiptoken"
+
+// Response is a canned response. A string Body is sent as is, any other Body is encoded as JSON.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   any
+}
+
+type route struct {
+	// responses are served in order, the last one is repeated.
+	responses []Response
+	// pages are served as OData pages linked by @odata.nextLink, if set.
+	pages [][]any
+	// fn computes the response, if set.
+	fn func(query url.Values) Response
+}
+
+// Server is a fake of the Microsoft APIs used by the collectors. Unknown routes are answered with 404.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	routes map[string]*route
+	calls  map[string]int
+}
+
+// New starts a server, which is closed when the test finishes.
+func New(tb testing.TB) *Server {
+	tb.Helper()
+
+	s := &Server{
+		routes: map[string]*route{},
+		calls:  map[string]int{},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	tb.Cleanup(s.Close)
+
+	return s
+}
+
+// Environment returns an environment with all endpoints pointing to the server.
+func (s *Server) Environment() cloud.Environment {
+	return cloud.Environment{
+		Name:                    "Fake",
+		GraphEndpoint:           s.URL,
+		ARMEndpoint:             s.URL,
+		ExchangeEndpoint:        s.URL,
+		SharePointDomain:        "sharepoint.com",
+		SharePointAdminEndpoint: s.URL,
+		AuthorityHost:           s.URL + "/",
+	}
+}
+
+// GraphClient returns a Graph client sending all requests to the server.
+func (s *Server) GraphClient(tb testing.TB) *msgraphsdk.GraphServiceClient {
+	tb.Helper()
+
+	client, err := auth.NewMSGraphClientWithCredential(s.Client(), s.Environment(), auth.NewStaticCredential("fake-token"))
+	require.NoError(tb, err)
+
+	return client
+}
+
+// Handle serves responses in order for requests to method and path, the last response is repeated.
+func (s *Server) Handle(method, path string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes[routeKey(method, path)] = &route{responses: responses}
+}
+
+// HandleFunc serves the response returned by fn for requests to method and path, e.g. to answer
+// depending on $filter.
+func (s *Server) HandleFunc(method, path string, fn func(query url.Values) Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes[routeKey(method, path)] = &route{fn: fn}
+}
+
+// JSON serves body for GET requests to path.
+func (s *Server) JSON(path string, body any) {
+	s.Handle(http.MethodGet, path, Response{Status: http.StatusOK, Body: body})
+}
+
+// Pages serves each page as OData collection for GET requests to path. All pages but the last
+// contain an @odata.nextLink to the next page.
+func (s *Server) Pages(path string, pages ...[]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes[routeKey(http.MethodGet, path)] = &route{pages: pages}
+}
+
+// Count serves n as plain text for GET requests to path/$count.
+func (s *Server) Count(path string, n int) {
+	s.Handle(http.MethodGet, path+"/$count", Response{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": []string{"text/plain"}},
+		Body:   strconv.Itoa(n),
+	})
+}
+
+// Error answers requests to method and path with an OData error.
+func (s *Server) Error(method, path string, status int, code, message string) {
+	s.Handle(method, path, ErrorResponse(status, code, message))
+}
+
+// Throttle answers the next times requests to method and path with 429 before serving the registered route.
+func (s *Server) Throttle(method, path string, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.routes[routeKey(method, path)]
+	if !ok {
+		r = &route{}
+		s.routes[routeKey(method, path)] = r
+	}
+
+	throttled := make([]Response, times)
+	for i := range throttled {
+		throttled[i] = ErrorResponse(http.StatusTooManyRequests, "TooManyRequests", "Too many requests")
+		throttled[i].Header.Set("Retry-After", "0")
+	}
+
+	r.responses = append(throttled, r.responses...)
+}
+
+// Calls returns the number of requests to method and path, including requests in a $batch.
+func (s *Server) Calls(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[routeKey(method, path)]
+}
+
+// ErrorResponse returns an OData error, as sent by Graph, ARM and the Exchange admin API.
+func ErrorResponse(status int, code, message string) Response {
+	return Response{
+		Status: status,
+		Header: http.Header{"Content-Type": []string{"application/json"}},
+		Body: map[string]any{
+			"error": map[string]any{"code": code, "message": message},
+		},
+	}
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		status int
+		header http.Header
+		body   []byte
+	)
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/$batch"):
+		status, header, body = s.serveBatch(r)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/InvokeCommand"):
+		status, header, body = s.serve(r.Method, s.cmdletURL(r))
+	default:
+		status, header, body = s.serve(r.Method, r.URL)
+	}
+
+	for key, values := range header {
+		w.Header()[key] = values
+	}
+
+	w.WriteHeader(status)
+
+	_, _ = w.Write(body)
+}
+
+func (s *Server) serve(method string, u *url.URL) (int, http.Header, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := routeKey(method, u.Path)
+	s.calls[key]++
+
+	r, ok := s.routes[key]
+	if !ok || (r.responses == nil && r.pages == nil && r.fn == nil) {
+		return encode(ErrorResponse(http.StatusNotFound, "Request_ResourceNotFound", "no canned response for "+key))
+	}
+
+	if len(r.responses) > 0 {
+		response := r.responses[0]
+
+		// the last response is repeated, unless pages or fn follow, e.g. after throttling
+		if len(r.responses) > 1 || r.pages != nil || r.fn != nil {
+			r.responses = r.responses[1:]
+		}
+
+		return encode(response)
+	}
+
+	if r.fn != nil {
+		return encode(r.fn(u.Query()))
+	}
+
+	page := 0
+	if token := u.Query().Get(skipTokenParam); token != "" {
+		page, _ = strconv.Atoi(token)
+	}
+
+	if page >= len(r.pages) {
+		return encode(ErrorResponse(http.StatusBadRequest, "BadRequest", "invalid "+skipTokenParam))
+	}
+
+	collection := map[string]any{"value": r.pages[page]}
+	if page+1 < len(r.pages) {
+		collection["@odata.nextLink"] = fmt.Sprintf("%s%s?%s=%d", s.URL, u.Path, skipTokenParam, page+1)
+	}
+
+	if u.Query().Get("$count") == "true" {
+		count := 0
+		for _, p := range r.pages {
+			count += len(p)
+		}
+
+		collection["@odata.count"] = count
+	}
+
+	return encode(Response{Status: http.StatusOK, Body: collection})
+}
+
+type batchRequest struct {
+	Requests []struct {
+		ID     string `json:"id"`
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"requests"`
+}
+
+type batchResponseItem struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// cmdletURL returns the URL of the route of the invoked cmdlet, if there is one, or the URL of the request.
+func (s *Server) cmdletURL(r *http.Request) *url.URL {
+	var request struct {
+		CmdletInput struct {
+			CmdletName string `json:"CmdletName"`
+		} `json:"CmdletInput"`
+	}
+
+	if json.NewDecoder(r.Body).Decode(&request) != nil || request.CmdletInput.CmdletName == "" {
+		return r.URL
+	}
+
+	u := *r.URL
+	u.Path += "/" + request.CmdletInput.CmdletName
+
+	s.mu.Lock()
+	_, ok := s.routes[routeKey(r.Method, u.Path)]
+	s.mu.Unlock()
+
+	if !ok {
+		return r.URL
+	}
+
+	return &u
+}
+
+// serveBatch answers a JSON batch request by serving each of its requests.
+func (s *Server) serveBatch(r *http.Request) (int, http.Header, []byte) {
+	var batch batchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&batch)
+	if err != nil {
+		return encode(ErrorResponse(http.StatusBadRequest, "BadRequest", err.Error()))
+	}
+
+	version := strings.TrimSuffix(r.URL.Path, "/$batch")
+	responses := make([]batchResponseItem, 0, len(batch.Requests))
+
+	for _, req := range batch.Requests {
+		u, err := url.Parse(version + "/" + strings.TrimPrefix(req.URL, "/"))
+		if err != nil {
+			return encode(ErrorResponse(http.StatusBadRequest, "BadRequest", err.Error()))
+		}
+
+		status, header, body := s.serve(req.Method, u)
+
+		item := batchResponseItem{ID: req.ID, Status: status, Headers: map[string]string{}}
+		for key := range header {
+			item.Headers[key] = header.Get(key)
+		}
+
+		if json.Valid(body) {
+			item.Body = body
+		}
+
+		responses = append(responses, item)
+	}
+
+	return encode(Response{Status: http.StatusOK, Body: map[string]any{"responses": responses}})
+}
+
+func encode(response Response) (int, http.Header, []byte) {
+	header := response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if text, ok := response.Body.(string); ok {
+		return status, header, []byte(text)
+	}
+
+	var buf bytes.Buffer
+
+	if response.Body != nil {
+		if err := json.NewEncoder(&buf).Encode(response.Body); err != nil {
+			return http.StatusInternalServerError, http.Header{}, []byte(err.Error())
+		}
+	}
+
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+
+	return status, header, buf.Bytes()
+}
+
+// fixtureRoute is a route of a fixture file, see Load.
+type fixtureRoute struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header"`
+	Body   json.RawMessage   `json:"body"`
+	Text   string            `json:"text"`
+	Pages  [][]any           `json:"pages"`
+}
+
+// Load registers the routes of the JSON fixture file at path, which maps "METHOD /path" to a response:
+//
+//	{
+//	  "GET /v1.0/organization": {"body": {"value": []}},
+//	  "GET /v1.0/users": {"pages": [[{"id": "1"}], [{"id": "2"}]]},
+//	  "GET /v1.0/users/$count": {"text": "2"},
+//	  "GET /v1.0/groups": {"status": 403, "body": {"error": {"code": "Authorization_RequestDenied"}}}
+//	}
+//
+// A body is sent as JSON, a text as plain text and pages as OData pages, see Pages.
+func (s *Server) Load(tb testing.TB, path string) {
+	tb.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(tb, err)
+
+	var routes map[string]fixtureRoute
+
+	require.NoError(tb, json.Unmarshal(content, &routes), "invalid fixture %s", path)
+
+	for key, r := range routes {
+		method, routePath, ok := strings.Cut(key, " ")
+		require.True(tb, ok, "invalid route %q in fixture %s, expected \"METHOD /path\"", key, path)
+
+		switch {
+		case r.Pages != nil:
+			s.mu.Lock()
+			s.routes[routeKey(method, routePath)] = &route{pages: r.Pages}
+			s.mu.Unlock()
+		case r.Text != "":
+			s.Handle(method, routePath, Response{Status: r.Status, Header: fixtureHeader(r.Header, "text/plain"), Body: r.Text})
+		default:
+			s.Handle(method, routePath, Response{Status: r.Status, Header: fixtureHeader(r.Header, "application/json"), Body: string(r.Body)})
+		}
+	}
+}
+
+func fixtureHeader(values map[string]string, contentType string) http.Header {
+	header := http.Header{"Content-Type": []string{contentType}}
+	for key, value := range values {
+		header.Set(key, value)
+	}
+
+	return header
+}
+
+// Fixture returns a response serving the content of the JSON file at path.
+func Fixture(tb testing.TB, path string) Response {
+	tb.Helper()
+
+	body, err := os.ReadFile(path)
+	require.NoError(tb, err)
+
+	return Response{Status: http.StatusOK, Header: http.Header{"Content-Type": []string{"application/json"}}, Body: string(body)}
+}
@@ -0,0 +1,241 @@
+package fakegraph_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/pkg/graphbatch"
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	graphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
+	"github.com/microsoftgraph/msgraph-sdk-go/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Pages(t *testing.T) {
+	t.Parallel()
+
+	server := fakegraph.New(t)
+	server.Pages("/v1.0/users",
+		[]any{map[string]any{"id": "1", "userPrincipalName": "alice@contoso.com"}},
+		[]any{map[string]any{"id": "2", "userPrincipalName": "bob@contoso.com"}},
+	)
+
+	client := server.GraphClient(t)
+
+	result, err := client.Users().Get(context.Background(), nil)
+	require.NoError(t, err)
+
+	iterator, err := graphcore.NewPageIterator[models.Userable](result, client.GetAdapter(), models.CreateUserCollectionResponseFromDiscriminatorValue)
+	require.NoError(t, err)
+
+	var upns []string
+
+	err = iterator.Iterate(context.Background(), func(user models.Userable) bool {
+		upns = append(upns, *user.GetUserPrincipalName())
+
+		return true
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alice@contoso.com", "bob@contoso.com"}, upns)
+	assert.Equal(t, 2, server.Calls(http.MethodGet, "/v1.0/users"))
+}
+
+func TestServer_Count(t *testing.T) {
+	t.Parallel()
+
+	server := fakegraph.New(t)
+	server.Count("/v1.0/users", 42)
+
+	headers := abstractions.NewRequestHeaders()
+	headers.Add("ConsistencyLevel", "eventual")
+
+	count, err := server.GraphClient(t).Users().Count().Get(context.Background(), &users.CountRequestBuilderGetRequestConfiguration{
+		Headers: headers,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(42), *count)
+}
+
+func TestServer_HandleFunc(t *testing.T) {
+	t.Parallel()
+
+	server := fakegraph.New(t)
+	server.HandleFunc(http.MethodGet, "/v1.0/users/$count", func(query url.Values) fakegraph.Response {
+		if query.Get("$filter") == "accountEnabled eq true" {
+			return fakegraph.Response{Body: "3"}
+		}
+
+		return fakegraph.Response{Body: "1"}
+	})
+
+	filter := "accountEnabled eq true"
+
+	count, err := server.GraphClient(t).Users().Count().Get(context.Background(), &users.CountRequestBuilderGetRequestConfiguration{
+		QueryParameters: &users.CountRequestBuilderGetQueryParameters{Filter: &filter},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), *count)
+}
+
+func TestServer_Error(t *testing.T) {
+	t.Parallel()
+
+	server := fakegraph.New(t)
+	server.Error(http.MethodGet, "/v1.0/organization", http.StatusForbidden, "Authorization_RequestDenied", "Insufficient privileges")
+
+	_, err := server.GraphClient(t).Organization().Get(context.Background(), nil)
+
+	var odataErr *odataerrors.ODataError
+
+	require.ErrorAs(t, err, &odataErr)
+	assert.Equal(t, http.StatusForbidden, odataErr.ResponseStatusCode)
+	assert.Equal(t, "Authorization_RequestDenied", *odataErr.GetErrorEscaped().GetCode())
+}
+
+func TestServer_Throttle(t *testing.T) {
+	t.Parallel()
+
+	server := fakegraph.New(t)
+	server.JSON("/v1.0/organization", map[string]any{"value": []any{map[string]any{"id": "org"}}})
+	server.Throttle(http.MethodGet, "/v1.0/organization", 2)
+
+	client := server.GraphClient(t)
+
+	for range 2 {
+		_, err := client.Organization().Get(context.Background(), nil)
+
+		var odataErr *odataerrors.ODataError
+
+		require.ErrorAs(t, err, &odataErr)
+		assert.Equal(t, http.StatusTooManyRequests, odataErr.ResponseStatusCode)
+	}
+
+	result, err := client.Organization().Get(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, result.GetValue(), 1)
+	assert.Equal(t, 3, server.Calls(http.MethodGet, "/v1.0/organization"))
+}
+
+func TestServer_Batch(t *testing.T) {
+	t.Parallel()
+
+	server := fakegraph.New(t)
+	server.JSON("/v1.0/teams/1", map[string]any{"id": "1", "displayName": "Team 1"})
+
+	client := server.GraphClient(t)
+
+	var requests []graphbatch.Request
+
+	for _, id := range []string{"1", "2"} {
+		info, err := client.Teams().ByTeamId(id).ToGetRequestInformation(context.Background(), nil)
+		require.NoError(t, err)
+
+		requests = append(requests, graphbatch.Request{Key: id, Info: info})
+	}
+
+	results, err := graphbatch.Execute[models.Teamable](context.Background(), client.GetAdapter(), requests,
+		models.CreateTeamFromDiscriminatorValue, graphbatch.Settings{},
+	)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "Team 1", *results[0].Value.GetDisplayName())
+
+	var odataErr *odataerrors.ODataError
+
+	require.True(t, errors.As(results[1].Err, &odataErr))
+	assert.Equal(t, http.StatusNotFound, odataErr.ResponseStatusCode)
+}
+
+func TestServer_RawHTTP(t *testing.T) {
+	t.Parallel()
+
+	server := fakegraph.New(t)
+	server.JSON("/providers/Microsoft.ADHybridHealthService/services", map[string]any{"value": []any{}})
+
+	env := server.Environment()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+		env.ARMEndpoint+"/providers/Microsoft.ADHybridHealthService/services?api-version=2014-01-01", nil)
+	require.NoError(t, err)
+
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"value":[]}`, string(body))
+	assert.Equal(t, server.URL, env.SharePointAdminURL("contoso"))
+}
+
+func TestServer_Load(t *testing.T) {
+	t.Parallel()
+
+	server := fakegraph.New(t)
+	server.Load(t, "testdata/routes.json")
+
+	client := server.GraphClient(t)
+
+	organization, err := client.Organization().Get(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "org", *organization.GetValue()[0].GetId())
+
+	result, err := client.Users().Get(context.Background(), nil)
+	require.NoError(t, err)
+	assert.NotNil(t, result.GetOdataNextLink())
+
+	count, err := client.Users().Count().Get(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), *count)
+
+	_, err = client.Groups().Get(context.Background(), nil)
+
+	var odataErr *odataerrors.ODataError
+
+	require.ErrorAs(t, err, &odataErr)
+	assert.Equal(t, http.StatusForbidden, odataErr.ResponseStatusCode)
+}
+
+func TestServer_InvokeCommand(t *testing.T) {
+	t.Parallel()
+
+	const path = "/adminapi/beta/contoso.onmicrosoft.com/InvokeCommand"
+
+	server := fakegraph.New(t)
+	server.Handle(http.MethodPost, path, fakegraph.Response{Body: map[string]any{"value": []any{"any"}}})
+	server.Handle(http.MethodPost, path+"/Get-AcceptedDomain", fakegraph.Response{Body: map[string]any{"value": []any{"domain"}}})
+
+	invoke := func(cmdlet string) string {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL+path,
+			strings.NewReader(`{"CmdletInput":{"CmdletName":"`+cmdlet+`"}}`))
+		require.NoError(t, err)
+
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return string(body)
+	}
+
+	assert.JSONEq(t, `{"value":["domain"]}`, invoke("Get-AcceptedDomain"))
+	assert.JSONEq(t, `{"value":["any"]}`, invoke("Get-MailFlowStatusReport"))
+	assert.Equal(t, 1, server.Calls(http.MethodPost, path+"/Get-AcceptedDomain"))
+}
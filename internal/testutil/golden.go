@@ -0,0 +1,98 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata instead of comparing against them")
+
+// AssertGolden compares metrics with the golden file at path, which contains the expected metrics in the
+// Prometheus text format. If the test runs with -update, the golden file is written instead.
+func AssertGolden(tb testing.TB, path string, metrics []prometheus.Metric) {
+	tb.Helper()
+
+	if *update {
+		text, err := MetricsToText(tb, metrics)
+		require.NoError(tb, err)
+
+		require.NoError(tb, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(tb, os.WriteFile(path, []byte(text), 0o600))
+
+		return
+	}
+
+	golden, err := os.Open(path)
+	require.NoError(tb, err, "golden file missing, run the test with -update to create it")
+
+	defer golden.Close()
+
+	assert.NoError(tb, promtestutil.CollectAndCompare(&collector{metrics: metrics}, golden), "metrics differ from %s, "+
+		"run the test with -update if the change is intended", path)
+}
+
+// Scraper is implemented by every collector.
+type Scraper interface {
+	ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, error)
+}
+
+// GoldenCase is a test case of RunGolden. The fake API serves the fixture testdata/<Fixture>.json, if it exists, and
+// the metrics are compared with testdata/<Name>.prom. Fixture defaults to Name.
+type GoldenCase[S any] struct {
+	Name     string
+	Fixture  string
+	Settings S
+	WantErr  bool
+}
+
+// RunGolden runs every case as parallel subtest: it scrapes the collector returned by newCollector and compares the
+// metrics with the golden file of the case. newCollector can add further routes to the fake API.
+func RunGolden[S any](t *testing.T, cases []GoldenCase[S], newCollector func(tb testing.TB, logger *slog.Logger, server *fakegraph.Server, settings S) Scraper) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			// TODO: Go 1.24: Change to slog.NewDiscardHandler
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			fixture := tc.Fixture
+			if fixture == "" {
+				fixture = tc.Name
+			}
+
+			server := fakegraph.New(t)
+
+			path := filepath.Join("testdata", fixture+".json")
+			if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+				server.Load(t, path)
+			}
+
+			collector := newCollector(t, logger, server, tc.Settings)
+
+			// TODO: Go 1.24: Change to t.Context()
+			metrics, err := collector.ScrapeMetrics(context.Background())
+			if tc.WantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			AssertGolden(t, filepath.Join("testdata", tc.Name+".prom"), metrics)
+		})
+	}
+}
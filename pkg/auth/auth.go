@@ -5,30 +5,36 @@ import (
 	"net/http"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	"github.com/microsoftgraph/msgraph-sdk-go-core/authentication"
 )
 
-func NewMSGraphClient(httpClient *http.Client) (*msgraphsdk.GraphServiceClient, *azidentity.DefaultAzureCredential, error) {
-	cred, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
-		ClientOptions: azcore.ClientOptions{
-			Transport: httpClient,
-		},
-	})
+func NewMSGraphClient(httpClient *http.Client, env cloud.Environment, settings Settings) (*msgraphsdk.GraphServiceClient, azcore.TokenCredential, error) {
+	cred, err := NewCredential(settings, env, httpClient)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating azure credential: %w", err)
 	}
 
-	scopes := []string{"https://graph.microsoft.com/.default"}
+	client, err := NewMSGraphClientWithCredential(httpClient, env, cred)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, cred, nil
+}
+
+// NewMSGraphClientWithCredential creates a Graph client for env, which authenticates using cred.
+func NewMSGraphClientWithCredential(httpClient *http.Client, env cloud.Environment, cred azcore.TokenCredential) (*msgraphsdk.GraphServiceClient, error) {
+	scopes := []string{env.GraphEndpoint + "/.default"}
 
 	auth, err := authentication.NewAzureIdentityAuthenticationProviderWithScopesAndValidHosts(
 		cred,
 		scopes,
-		[]string{"graph.microsoft.com"},
+		[]string{env.GraphHost()},
 	)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating msgraph authentication provider: %w", err)
+		return nil, fmt.Errorf("error creating msgraph authentication provider: %w", err)
 	}
 
 	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(
@@ -38,8 +44,10 @@ func NewMSGraphClient(httpClient *http.Client) (*msgraphsdk.GraphServiceClient,
 		httpClient,
 	)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating msgraph request adapter: %w", err)
+		return nil, fmt.Errorf("error creating msgraph request adapter: %w", err)
 	}
 
-	return msgraphsdk.NewGraphServiceClient(adapter), cred, nil
+	adapter.SetBaseUrl(env.GraphEndpoint + "/v1.0")
+
+	return msgraphsdk.NewGraphServiceClient(adapter), nil
 }
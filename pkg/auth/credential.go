@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Authentication methods which can be selected via Settings.Method.
+const (
+	MethodDefault           = "default"
+	MethodClientSecret      = "clientSecret"
+	MethodClientCertificate = "clientCertificate"
+	MethodWorkloadIdentity  = "workloadIdentity"
+	MethodManagedIdentity   = "managedIdentity"
+)
+
+var errMissingClientID = errors.New("client id is required")
+
+// Settings selects and configures the credential used to authenticate against Microsoft APIs.
+type Settings struct {
+	// Method is one of the Method* constants, an empty value means MethodDefault.
+	Method   string
+	TenantID string
+	// ClientID of the app registration, or of the user-assigned managed identity.
+	ClientID string
+
+	// ClientSecret is used by MethodClientSecret, if ClientSecretFile is empty.
+	ClientSecret     string
+	ClientSecretFile string
+
+	// CertificatePath is a PEM or PFX file containing the certificate and its private key.
+	CertificatePath         string
+	CertificatePasswordFile string
+
+	// FederatedTokenFile is the path of the token exchanged by MethodWorkloadIdentity.
+	// Defaults to the AZURE_FEDERATED_TOKEN_FILE environment variable.
+	FederatedTokenFile string
+}
+
+// NewCredential creates the credential selected by settings.Method. All requests
+// of the credential, e.g. to the token authority of env, are sent through httpClient.
+func NewCredential(settings Settings, env cloud.Environment, httpClient *http.Client) (azcore.TokenCredential, error) {
+	clientOptions := azcore.ClientOptions{
+		Cloud:     env.AzureCloud(),
+		Transport: httpClient,
+	}
+
+	switch settings.Method {
+	case "", MethodDefault:
+		cred, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: clientOptions,
+			TenantID:      settings.TenantID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating default azure credential: %w", err)
+		}
+
+		return cred, nil
+	case MethodClientSecret:
+		if settings.ClientID == "" {
+			return nil, errMissingClientID
+		}
+
+		secret, err := readSecret(settings.ClientSecret, settings.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client secret: %w", err)
+		}
+
+		if secret == "" {
+			return nil, errors.New("client secret is required")
+		}
+
+		cred, err := azidentity.NewClientSecretCredential(settings.TenantID, settings.ClientID, secret,
+			&azidentity.ClientSecretCredentialOptions{ClientOptions: clientOptions},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating client secret credential: %w", err)
+		}
+
+		return cred, nil
+	case MethodClientCertificate:
+		if settings.ClientID == "" {
+			return nil, errMissingClientID
+		}
+
+		certData, err := os.ReadFile(settings.CertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client certificate: %w", err)
+		}
+
+		password, err := readSecret("", settings.CertificatePasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client certificate password: %w", err)
+		}
+
+		certs, key, err := azidentity.ParseCertificates(certData, []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing client certificate %s: %w", settings.CertificatePath, err)
+		}
+
+		cred, err := azidentity.NewClientCertificateCredential(settings.TenantID, settings.ClientID, certs, key,
+			&azidentity.ClientCertificateCredentialOptions{ClientOptions: clientOptions},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating client certificate credential: %w", err)
+		}
+
+		return cred, nil
+	case MethodWorkloadIdentity:
+		cred, err := azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions: clientOptions,
+			ClientID:      settings.ClientID,
+			TenantID:      settings.TenantID,
+			TokenFilePath: settings.FederatedTokenFile,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating workload identity credential: %w", err)
+		}
+
+		return cred, nil
+	case MethodManagedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions}
+
+		// without a client id, the system-assigned identity is used
+		if settings.ClientID != "" {
+			options.ID = azidentity.ClientID(settings.ClientID)
+		}
+
+		cred, err := azidentity.NewManagedIdentityCredential(options)
+		if err != nil {
+			return nil, fmt.Errorf("error creating managed identity credential: %w", err)
+		}
+
+		return cred, nil
+	}
+
+	return nil, fmt.Errorf("unknown authentication method %q", settings.Method)
+}
+
+// NewInfoCollector returns a collector exposing the selected authentication method as m365_auth_info.
+func NewInfoCollector(tenant string, settings Settings) prometheus.Collector {
+	method := settings.Method
+	if method == "" {
+		method = MethodDefault
+	}
+
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: abstract.Namespace,
+		Subsystem: "auth",
+		Name:      "info",
+		Help:      "Authentication method used to acquire tokens, the value is always 1",
+		ConstLabels: prometheus.Labels{
+			"tenant":    tenant,
+			"method":    method,
+			"client_id": settings.ClientID,
+		},
+	})
+	info.Set(1)
+
+	return info
+}
+
+// readSecret returns the content of file without surrounding whitespace, or value if file is empty.
+func readSecret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", file, err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCredential(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("s3cr3t\n"), 0o600))
+
+	certFile := filepath.Join(dir, "cert.pem")
+	require.NoError(t, os.WriteFile(certFile, selfSignedCertificate(t), 0o600))
+
+	for name, tc := range map[string]struct {
+		settings Settings
+		expected any
+		err      string
+	}{
+		"client secret from file": {
+			settings: Settings{Method: MethodClientSecret, TenantID: "tenant", ClientID: "client", ClientSecretFile: secretFile},
+			expected: &azidentity.ClientSecretCredential{},
+		},
+		"client secret without client id": {
+			settings: Settings{Method: MethodClientSecret, TenantID: "tenant", ClientSecret: "s3cr3t"},
+			err:      "client id is required",
+		},
+		"client secret missing": {
+			settings: Settings{Method: MethodClientSecret, TenantID: "tenant", ClientID: "client"},
+			err:      "client secret is required",
+		},
+		"client certificate": {
+			settings: Settings{Method: MethodClientCertificate, TenantID: "tenant", ClientID: "client", CertificatePath: certFile},
+			expected: &azidentity.ClientCertificateCredential{},
+		},
+		"client certificate missing file": {
+			settings: Settings{Method: MethodClientCertificate, TenantID: "tenant", ClientID: "client", CertificatePath: filepath.Join(dir, "missing.pem")},
+			err:      "error reading client certificate",
+		},
+		"user-assigned managed identity": {
+			settings: Settings{Method: MethodManagedIdentity, ClientID: "client"},
+			expected: &azidentity.ManagedIdentityCredential{},
+		},
+		"unknown method": {
+			settings: Settings{Method: "password"},
+			err:      `unknown authentication method "password"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cred, err := NewCredential(tc.settings, cloud.AzurePublic, http.DefaultClient)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.IsType(t, tc.expected, cred)
+		})
+	}
+}
+
+func TestNewInfoCollector(t *testing.T) {
+	t.Parallel()
+
+	collector := NewInfoCollector("tenant", Settings{ClientID: "client"})
+
+	expected := `
+# HELP m365_auth_info Authentication method used to acquire tokens, the value is always 1
+# TYPE m365_auth_info gauge
+m365_auth_info{client_id="client",method="default",tenant="tenant"} 1
+`
+
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
+
+func selfSignedCertificate(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "m365-exporter"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})...,
+	)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Interface guard.
+var _ azcore.TokenCredential = (*instrumentedCredential)(nil)
+
+type instrumentedCredential struct {
+	cred azcore.TokenCredential
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	expiry   *prometheus.GaugeVec
+}
+
+// NewInstrumentedCredential wraps cred and records every token request per resource, i.e. the host of the
+// requested scope. Since the credentials of the Azure SDK cache tokens, most requests are served from the cache.
+func NewInstrumentedCredential(reg prometheus.Registerer, cred azcore.TokenCredential) azcore.TokenCredential {
+	c := &instrumentedCredential{
+		cred: cred,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: abstract.Namespace,
+			Subsystem: "auth",
+			Name:      "token_requests_total",
+			Help:      "Number of token requests by resource and result",
+		}, []string{"resource", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: abstract.Namespace,
+			Subsystem: "auth",
+			Name:      "token_request_duration_seconds",
+			Help:      "Latency of token requests by resource, including requests served from the token cache",
+			Buckets:   []float64{0.001, 0.01, 0.1, 0.3, 1, 3, 10},
+		}, []string{"resource"}),
+		expiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: abstract.Namespace,
+			Subsystem: "auth",
+			Name:      "token_expiry_seconds_timestamp",
+			Help:      "Unix time the most recently acquired token of a resource expires",
+		}, []string{"resource"}),
+	}
+
+	reg.MustRegister(c.requests, c.duration, c.expiry)
+
+	return c
+}
+
+func (c *instrumentedCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	resource := resourceOf(options.Scopes)
+	start := time.Now()
+
+	token, err := c.cred.GetToken(ctx, options)
+
+	c.duration.WithLabelValues(resource).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		c.requests.WithLabelValues(resource, "error").Inc()
+
+		return token, fmt.Errorf("error requesting token for %s: %w", resource, err)
+	}
+
+	c.requests.WithLabelValues(resource, "success").Inc()
+	c.expiry.WithLabelValues(resource).Set(float64(token.ExpiresOn.Unix()))
+
+	return token, nil
+}
+
+// resourceOf returns the host of the first scope, e.g. graph.microsoft.com for https://graph.microsoft.com/.default.
+func resourceOf(scopes []string) string {
+	if len(scopes) == 0 {
+		return "unknown"
+	}
+
+	scope := strings.TrimSuffix(scopes[0], "/.default")
+
+	u, err := url.Parse(scope)
+	if err != nil || u.Host == "" {
+		return scope
+	}
+
+	return u.Host
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCredential struct {
+	token azcore.AccessToken
+	err   error
+}
+
+func (f fakeCredential) GetToken(_ context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return f.token, f.err
+}
+
+func TestNewInstrumentedCredential(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+
+	cred := NewInstrumentedCredential(reg, fakeCredential{
+		token: azcore.AccessToken{Token: "token", ExpiresOn: time.Unix(1700000000, 0)},
+	})
+
+	_, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"https://graph.microsoft.com/.default"}})
+	require.NoError(t, err)
+
+	failing := NewInstrumentedCredential(prometheus.NewRegistry(), fakeCredential{err: errors.New("boom")})
+
+	_, err = failing.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"https://management.azure.com/.default"}})
+	require.ErrorContains(t, err, "management.azure.com: boom")
+
+	expected := `
+# HELP m365_auth_token_expiry_seconds_timestamp Unix time the most recently acquired token of a resource expires
+# TYPE m365_auth_token_expiry_seconds_timestamp gauge
+m365_auth_token_expiry_seconds_timestamp{resource="graph.microsoft.com"} 1.7e+09
+# HELP m365_auth_token_requests_total Number of token requests by resource and result
+# TYPE m365_auth_token_requests_total counter
+m365_auth_token_requests_total{resource="graph.microsoft.com",result="success"} 1
+`
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"m365_auth_token_expiry_seconds_timestamp", "m365_auth_token_requests_total",
+	))
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sharePointResourceID is the application ID of Office 365 SharePoint Online. It is used as scope, since
+// the host of the SharePoint admin API depends on the tenant name.
+const sharePointResourceID = "00000003-0000-0ff1-ce00-000000000000"
+
+// PermissionChecker compares the permissions required by collectors with the roles of the access token
+// of each resource. The roles of a resource are requested once and reused for all collectors.
+type PermissionChecker struct {
+	cred   azcore.TokenCredential
+	scopes map[string]string
+
+	mu    sync.Mutex
+	roles map[string][]string
+	errs  map[string]error
+
+	missingGauge *prometheus.GaugeVec
+}
+
+func NewPermissionChecker(reg prometheus.Registerer, cred azcore.TokenCredential, env cloud.Environment) *PermissionChecker {
+	checker := &PermissionChecker{
+		cred: cred,
+		// Azure RBAC assignments are not part of the token, so ResourceARM can't be checked.
+		scopes: map[string]string{
+			abstract.ResourceGraph:      env.GraphEndpoint + "/.default",
+			abstract.ResourceExchange:   env.ExchangeEndpoint + "/.default",
+			abstract.ResourceSharePoint: sharePointResourceID + "/.default",
+		},
+		roles: map[string][]string{},
+		errs:  map[string]error{},
+		missingGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: abstract.Namespace,
+			Subsystem: "collector",
+			Name:      "permission_missing",
+			Help:      "Whether a permission required by a collector is missing in the access token (1) or granted (0)",
+		}, []string{"collector", "permission"}),
+	}
+
+	reg.MustRegister(checker.missingGauge)
+
+	return checker
+}
+
+// Missing returns the permissions of required that are not granted. Permissions which can't be verified are
+// skipped. If the roles of a resource can't be determined, an error is returned along with the verified results.
+func (p *PermissionChecker) Missing(ctx context.Context, collector string, required []abstract.Permission) ([]abstract.Permission, error) {
+	var missing []abstract.Permission
+
+	errs := map[string]error{}
+
+	for _, permission := range required {
+		if _, ok := p.scopes[permission.Resource]; !ok {
+			continue
+		}
+
+		roles, err := p.grantedRoles(ctx, permission.Resource)
+		if err != nil {
+			errs[permission.Resource] = err
+
+			continue
+		}
+
+		if hasRole(roles, permission.Name) {
+			p.missingGauge.WithLabelValues(collector, permission.Name).Set(0)
+
+			continue
+		}
+
+		p.missingGauge.WithLabelValues(collector, permission.Name).Set(1)
+
+		missing = append(missing, permission)
+	}
+
+	return missing, errors.Join(slices.Collect(maps.Values(errs))...)
+}
+
+// Roles returns the granted roles of all resources requested so far.
+func (p *PermissionChecker) Roles() map[string][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return maps.Clone(p.roles)
+}
+
+func (p *PermissionChecker) grantedRoles(ctx context.Context, resource string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if roles, ok := p.roles[resource]; ok {
+		return roles, nil
+	}
+
+	// don't request a failing token again for every permission
+	if err, ok := p.errs[resource]; ok {
+		return nil, err
+	}
+
+	roles, err := GrantedRoles(ctx, p.cred, p.scopes[resource])
+	if err != nil {
+		p.errs[resource] = fmt.Errorf("error determining granted %s permissions: %w", resource, err)
+
+		return nil, p.errs[resource]
+	}
+
+	p.roles[resource] = roles
+
+	return roles, nil
+}
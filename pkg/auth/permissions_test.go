@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scopedCredential returns a token with the given roles per scope, and an error for all other scopes.
+type scopedCredential map[string][]string
+
+func (s scopedCredential) GetToken(_ context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	roles, ok := s[options.Scopes[0]]
+	if !ok {
+		return azcore.AccessToken{}, errors.New("no token for " + options.Scopes[0])
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"roles":["` + strings.Join(roles, `","`) + `"]}`))
+
+	return azcore.AccessToken{Token: "header." + payload + ".signature"}, nil
+}
+
+func TestPermissionChecker_Missing(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+
+	checker := NewPermissionChecker(reg, scopedCredential{
+		"https://graph.microsoft.com/.default": {"Directory.Read.All", "Sites.Read.All"},
+	}, cloud.AzurePublic)
+
+	missing, err := checker.Missing(context.Background(), "sharepoint", []abstract.Permission{
+		{Resource: abstract.ResourceGraph, Name: "Sites.Read.All"},
+		{Resource: abstract.ResourceGraph, Name: "Files.Read.All"},
+		{Resource: abstract.ResourceARM, Name: "Microsoft.ADHybridHealthService/services/read"},
+		{Resource: abstract.ResourceSharePoint, Name: "Sites.FullControl.All"},
+	})
+	require.ErrorContains(t, err, "error determining granted sharepoint permissions")
+	assert.Equal(t, []abstract.Permission{{Resource: abstract.ResourceGraph, Name: "Files.Read.All"}}, missing)
+
+	assert.Equal(t, map[string][]string{
+		abstract.ResourceGraph: {"Directory.Read.All", "Sites.Read.All"},
+	}, checker.Roles())
+
+	expected := `
+# HELP m365_collector_permission_missing Whether a permission required by a collector is missing in the access token (1) or granted (0)
+# TYPE m365_collector_permission_missing gauge
+m365_collector_permission_missing{collector="sharepoint",permission="Files.Read.All"} 1
+m365_collector_permission_missing{collector="sharepoint",permission="Sites.Read.All"} 0
+`
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected)))
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// impliedRoles lists application permissions which include other, narrower permissions.
+var impliedRoles = map[string][]string{
+	"Directory.Read.All": {
+		"User.Read.All", "Group.Read.All", "Application.Read.All", "Organization.Read.All", "Device.Read.All",
+	},
+}
+
+// GrantedRoles requests a token for scope and returns the application permissions of its roles claim.
+// The token is only decoded, not validated, since it is never used for authorization decisions.
+func GrantedRoles(ctx context.Context, cred azcore.TokenCredential, scope string) ([]string, error) {
+	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{scope}})
+	if err != nil {
+		return nil, fmt.Errorf("error requesting token: %w", err)
+	}
+
+	return parseRoles(token.Token)
+}
+
+func parseRoles(token string) ([]string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("access token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding access token payload: %w", err)
+	}
+
+	var claims struct {
+		Roles []string `json:"roles"`
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling access token claims: %w", err)
+	}
+
+	slices.Sort(claims.Roles)
+
+	return claims.Roles, nil
+}
+
+// MissingRoles returns all roles of required which are not part of granted. A required
+// Read permission is also satisfied by the ReadWrite permission, or by a permission implying it.
+func MissingRoles(granted, required []string) []string {
+	var missing []string
+
+	for _, role := range required {
+		if !hasRole(granted, role) {
+			missing = append(missing, role)
+		}
+	}
+
+	return missing
+}
+
+func hasRole(granted []string, role string) bool {
+	if slices.Contains(granted, role) || slices.Contains(granted, strings.Replace(role, ".Read.", ".ReadWrite.", 1)) {
+		return true
+	}
+
+	for _, grantedRole := range granted {
+		if slices.Contains(impliedRoles[grantedRole], role) {
+			return true
+		}
+	}
+
+	return false
+}
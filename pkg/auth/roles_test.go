@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrantedRoles(t *testing.T) {
+	t.Parallel()
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"https://graph.microsoft.com","roles":["User.Read.All","Directory.Read.All"]}`))
+
+	roles, err := GrantedRoles(context.Background(), fakeCredential{
+		token: azcore.AccessToken{Token: "eyJhbGciOiJub25lIn0." + payload + ".signature"},
+	}, "https://graph.microsoft.com/.default")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Directory.Read.All", "User.Read.All"}, roles)
+
+	_, err = GrantedRoles(context.Background(), fakeCredential{
+		token: azcore.AccessToken{Token: "opaque"},
+	}, "https://graph.microsoft.com/.default")
+	require.Error(t, err)
+}
+
+func TestMissingRoles(t *testing.T) {
+	t.Parallel()
+
+	granted := []string{"Directory.Read.All", "Sites.ReadWrite.All"}
+
+	assert.Empty(t, MissingRoles(granted, []string{"User.Read.All", "Sites.Read.All", "Directory.Read.All"}))
+	assert.Equal(t,
+		[]string{"DeviceManagementManagedDevices.Read.All"},
+		MissingRoles(granted, []string{"Organization.Read.All", "DeviceManagementManagedDevices.Read.All"}),
+	)
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// Interface guard.
+var _ azcore.TokenCredential = staticCredential("")
+
+type staticCredential string
+
+// NewStaticCredential returns a credential which always returns token without contacting Entra ID,
+// e.g. for replayed responses or fake APIs.
+func NewStaticCredential(token string) azcore.TokenCredential {
+	return staticCredential(token)
+}
+
+func (c staticCredential) GetToken(_ context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: string(c), ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
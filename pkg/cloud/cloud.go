@@ -0,0 +1,134 @@
+// Package cloud describes the endpoints of the Microsoft 365 national clouds.
+//
+// https://learn.microsoft.com/en-us/graph/deployments
+package cloud
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	azcloud "github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+)
+
+// Environment holds all endpoints the exporter talks to in one cloud.
+type Environment struct {
+	Name string
+	// GraphEndpoint is the base URL of Microsoft Graph, without API version.
+	GraphEndpoint string
+	// ARMEndpoint is the base URL of Azure Resource Manager.
+	ARMEndpoint string
+	// ExchangeEndpoint is the base URL of the Exchange Online admin API.
+	ExchangeEndpoint string
+	// SharePointDomain is the domain of SharePoint Online tenants, e.g. contoso.sharepoint.com.
+	SharePointDomain string
+	// SharePointAdminEndpoint overrides the tenant specific SharePoint admin URL, e.g. to point to a local test server.
+	SharePointAdminEndpoint string
+	// AuthorityHost is the Entra ID endpoint tokens are requested from.
+	AuthorityHost string
+}
+
+var (
+	// AzurePublic is the global Microsoft 365 cloud, also used by GCC tenants.
+	AzurePublic = Environment{
+		Name:             "AzurePublic",
+		GraphEndpoint:    "https://graph.microsoft.com",
+		ARMEndpoint:      "https://management.azure.com",
+		ExchangeEndpoint: "https://outlook.office365.com",
+		SharePointDomain: "sharepoint.com",
+		AuthorityHost:    azcloud.AzurePublic.ActiveDirectoryAuthorityHost,
+	}
+
+	// AzureUSGovernment is Microsoft 365 GCC High.
+	AzureUSGovernment = Environment{
+		Name:             "AzureUSGovernment",
+		GraphEndpoint:    "https://graph.microsoft.us",
+		ARMEndpoint:      "https://management.usgovcloudapi.net",
+		ExchangeEndpoint: "https://outlook.office365.us",
+		SharePointDomain: "sharepoint.us",
+		AuthorityHost:    azcloud.AzureGovernment.ActiveDirectoryAuthorityHost,
+	}
+
+	// AzureUSGovernmentDoD is Microsoft 365 DoD.
+	AzureUSGovernmentDoD = Environment{
+		Name:             "AzureUSGovernmentDoD",
+		GraphEndpoint:    "https://dod-graph.microsoft.us",
+		ARMEndpoint:      "https://management.usgovcloudapi.net",
+		ExchangeEndpoint: "https://webmail.apps.mil",
+		SharePointDomain: "sharepoint-mil.us",
+		AuthorityHost:    azcloud.AzureGovernment.ActiveDirectoryAuthorityHost,
+	}
+
+	// AzureChina is Microsoft 365 operated by 21Vianet.
+	AzureChina = Environment{
+		Name:             "AzureChina",
+		GraphEndpoint:    "https://microsoftgraph.chinacloudapi.cn",
+		ARMEndpoint:      "https://management.chinacloudapi.cn",
+		ExchangeEndpoint: "https://partner.outlook.cn",
+		SharePointDomain: "sharepoint.cn",
+		AuthorityHost:    azcloud.AzureChina.ActiveDirectoryAuthorityHost,
+	}
+)
+
+// Lookup returns the environment with the given name. The name is case-insensitive,
+// besides the environment names the aliases "public", "gcchigh", "dod" and "china" are accepted.
+func Lookup(name string) (Environment, error) {
+	switch strings.ToLower(name) {
+	case "", "azurepublic", "public", "gcc":
+		return AzurePublic, nil
+	case "azureusgovernment", "gcchigh", "usgov":
+		return AzureUSGovernment, nil
+	case "azureusgovernmentdod", "dod":
+		return AzureUSGovernmentDoD, nil
+	case "azurechina", "china":
+		return AzureChina, nil
+	}
+
+	return Environment{}, fmt.Errorf("unknown cloud %q", name)
+}
+
+// GraphHost returns the host name of Microsoft Graph.
+func (e Environment) GraphHost() string {
+	return hostOf(e.GraphEndpoint)
+}
+
+// ARMHost returns the host name of Azure Resource Manager.
+func (e Environment) ARMHost() string {
+	return hostOf(e.ARMEndpoint)
+}
+
+// ExchangeHost returns the host name of the Exchange Online admin API.
+func (e Environment) ExchangeHost() string {
+	return hostOf(e.ExchangeEndpoint)
+}
+
+// SharePointAdminHostPattern returns a pattern matching all SharePoint admin hosts, e.g. "*-admin.sharepoint.com".
+func (e Environment) SharePointAdminHostPattern() string {
+	return "*-admin." + e.SharePointDomain
+}
+
+// SharePointAdminURL returns the base URL of the SharePoint admin API of the given tenant name.
+func (e Environment) SharePointAdminURL(tenantName string) string {
+	if e.SharePointAdminEndpoint != "" {
+		return e.SharePointAdminEndpoint
+	}
+
+	return fmt.Sprintf("https://%s-admin.%s", tenantName, e.SharePointDomain)
+}
+
+// AzureCloud returns the configuration used by the Azure SDK to acquire tokens.
+func (e Environment) AzureCloud() azcloud.Configuration {
+	return azcloud.Configuration{
+		ActiveDirectoryAuthorityHost: e.AuthorityHost,
+		Services:                     map[azcloud.ServiceName]azcloud.ServiceConfiguration{},
+	}
+}
+
+func hostOf(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+
+	return u.Host
+}
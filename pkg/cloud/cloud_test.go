@@ -0,0 +1,43 @@
+package cloud_test
+
+import (
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]cloud.Environment{
+		"":                     cloud.AzurePublic,
+		"AzurePublic":          cloud.AzurePublic,
+		"gcc":                  cloud.AzurePublic,
+		"AzureUSGovernment":    cloud.AzureUSGovernment,
+		"GCCHigh":              cloud.AzureUSGovernment,
+		"azureusgovernmentdod": cloud.AzureUSGovernmentDoD,
+		"china":                cloud.AzureChina,
+	} {
+		env, err := cloud.Lookup(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, env, name)
+	}
+
+	_, err := cloud.Lookup("AzureGermany")
+	require.Error(t, err)
+}
+
+func TestEnvironment_Hosts(t *testing.T) {
+	t.Parallel()
+
+	env := cloud.AzureUSGovernment
+
+	assert.Equal(t, "graph.microsoft.us", env.GraphHost())
+	assert.Equal(t, "management.usgovcloudapi.net", env.ARMHost())
+	assert.Equal(t, "outlook.office365.us", env.ExchangeHost())
+	assert.Equal(t, "*-admin.sharepoint.us", env.SharePointAdminHostPattern())
+	assert.Equal(t, "https://contoso-admin.sharepoint.us", env.SharePointAdminURL("contoso"))
+	assert.Equal(t, "https://login.microsoftonline.us/", env.AzureCloud().ActiveDirectoryAuthorityHost)
+}
@@ -110,6 +110,9 @@ func (c *BaseCollector) ScrapeWorker(
 		}
 	}()
 
+	// outbound requests of the collector are labeled with its name
+	ctx = WithCollector(ctx, c.subsystem)
+
 	for {
 		logger.DebugContext(ctx, "starting scrapeWorker")
 
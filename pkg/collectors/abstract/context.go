@@ -0,0 +1,17 @@
+package abstract
+
+import "context"
+
+type ctxCollectorValue struct{}
+
+// WithCollector returns a copy of ctx which carries the name of the collector issuing requests.
+func WithCollector(ctx context.Context, collector string) context.Context {
+	return context.WithValue(ctx, ctxCollectorValue{}, collector)
+}
+
+// CollectorFromContext returns the collector name set by WithCollector.
+func CollectorFromContext(ctx context.Context) (string, bool) {
+	collector, ok := ctx.Value(ctxCollectorValue{}).(string)
+
+	return collector, ok
+}
@@ -0,0 +1,42 @@
+package abstract
+
+// Resources an application permission can be granted on.
+const (
+	ResourceGraph      = "graph"
+	ResourceARM        = "arm"
+	ResourceExchange   = "exchange"
+	ResourceSharePoint = "sharepoint"
+)
+
+// Permission is a permission a collector needs on one of the Microsoft APIs.
+type Permission struct {
+	// Resource is one of the Resource* constants.
+	Resource string
+	// Name is the application permission, e.g. User.Read.All, or the Azure RBAC action for ResourceARM.
+	Name string
+	// Optional permissions only enable an optional section of the collector. A missing one is logged and reported,
+	// but never disables the collector.
+	Optional bool
+}
+
+// GraphPermissions returns a Permission on Microsoft Graph for each name.
+func GraphPermissions(names ...string) []Permission {
+	permissions := make([]Permission, 0, len(names))
+
+	for _, name := range names {
+		permissions = append(permissions, Permission{Resource: ResourceGraph, Name: name})
+	}
+
+	return permissions
+}
+
+// OptionalGraphPermissions returns an optional Permission on Microsoft Graph for each name.
+func OptionalGraphPermissions(names ...string) []Permission {
+	permissions := GraphPermissions(names...)
+
+	for i := range permissions {
+		permissions[i].Optional = true
+	}
+
+	return permissions
+}
@@ -0,0 +1,56 @@
+package abstract
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DefaultConcurrency is the number of workers used by ForEach if no concurrency is configured.
+const DefaultConcurrency = 4
+
+// ForEach calls fn for every item using up to concurrency workers and returns the results in the order of items.
+// All errors returned by fn are joined. Once ctx is done, no further items are started and the context error is
+// part of the returned error. The result of a failed item is the zero value of R.
+func ForEach[T, R any](ctx context.Context, concurrency int, items []T, fn func(ctx context.Context, item T) (R, error)) ([]R, error) {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	results := make([]R, len(items))
+	errs := make([]error, len(items))
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range min(concurrency, len(items)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				results[i], errs[i] = fn(ctx, items[i])
+			}
+		}()
+	}
+
+	var ctxErr error
+
+dispatch:
+	for i := range items {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+
+			break dispatch
+		}
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	return results, errors.Join(append(errs, ctxErr)...)
+}
@@ -0,0 +1,81 @@
+package abstract_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ForEach(t *testing.T) {
+	t.Parallel()
+
+	var (
+		current atomic.Int32
+		peak    atomic.Int32
+	)
+
+	items := []int{1, 2, 3, 4, 5, 6, 7, 8}
+
+	results, err := abstract.ForEach(context.Background(), 3, items, func(_ context.Context, item int) (int, error) {
+		n := current.Add(1)
+		defer current.Add(-1)
+
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		// finish in reverse order to verify that the results are ordered
+		time.Sleep(time.Duration(10-item) * time.Millisecond)
+
+		return item * 2, nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{2, 4, 6, 8, 10, 12, 14, 16}, results)
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+}
+
+func Test_ForEachJoinsErrors(t *testing.T) {
+	t.Parallel()
+
+	errOdd := errors.New("odd")
+
+	results, err := abstract.ForEach(context.Background(), 2, []int{1, 2, 3}, func(_ context.Context, item int) (int, error) {
+		if item%2 == 1 {
+			return 0, errOdd
+		}
+
+		return item, nil
+	})
+
+	require.ErrorIs(t, err, errOdd)
+	assert.Equal(t, []int{0, 2, 0}, results)
+}
+
+func Test_ForEachStopsOnCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls atomic.Int32
+
+	_, err := abstract.ForEach(ctx, 1, make([]int, 100), func(_ context.Context, _ int) (int, error) {
+		if calls.Add(1) == 2 {
+			cancel()
+		}
+
+		return 0, nil
+	})
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, calls.Load(), int32(100))
+}
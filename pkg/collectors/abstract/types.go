@@ -13,4 +13,6 @@ type Collector interface {
 	StartBackgroundWorker(ctx context.Context, interval time.Duration)
 	ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, error)
 	GetSubsystem() string
+	// RequiredPermissions returns the permissions the collector needs to scrape all of its metrics.
+	RequiredPermissions() []Permission
 }
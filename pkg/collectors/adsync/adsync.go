@@ -2,16 +2,17 @@ package adsync
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"slices"
 	"time"
 
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
+	"github.com/cloudeteer/m365-exporter/pkg/util"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	"github.com/microsoftgraph/msgraph-sdk-go/organization"
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,8 +21,8 @@ import (
 const subsystem = "adsync"
 
 const (
-	URLServiceADSyncError      = "https://management.azure.com/providers/Microsoft.ADHybridHealthService/services/%s/exporterrors/counts?api-version=2014-01-01"
-	URLAllServicesADSyncErrors = "https://management.azure.com/providers/Microsoft.ADHybridHealthService/services?api-version=2014-01-01"
+	PathServiceADSyncError      = "/providers/Microsoft.ADHybridHealthService/services/%s/exporterrors/counts?api-version=2014-01-01"
+	PathAllServicesADSyncErrors = "/providers/Microsoft.ADHybridHealthService/services?api-version=2014-01-01"
 )
 
 // Interface guard.
@@ -34,28 +35,55 @@ type Collector struct {
 
 	enabledDesc  *prometheus.Desc
 	lastSyncDesc *prometheus.Desc
+	syncAgeDesc  *prometheus.Desc
 	errorDesc    *prometheus.Desc
 
-	httpClient *http.Client
+	errorTruncatedDesc *prometheus.Desc
+	errorObjectsDesc   *prometheus.Desc
+	errorObjects       errorObjectStore
+
+	serversDesc    *prometheus.Desc
+	heartbeatDesc  *prometheus.Desc
+	lastExportDesc *prometheus.Desc
+	serverInfoDesc *prometheus.Desc
+	alertsDesc     *prometheus.Desc
+
+	featureDesc           *prometheus.Desc
+	deletionPreventedDesc *prometheus.Desc
+	deletionThresholdDesc *prometheus.Desc
+	lastPasswordSyncDesc  *prometheus.Desc
+	quotaUsedDesc         *prometheus.Desc
+	quotaTotalDesc        *prometheus.Desc
+
+	cloudSyncStatusDesc      *prometheus.Desc
+	cloudSyncFailuresDesc    *prometheus.Desc
+	cloudSyncQuarantineDesc  *prometheus.Desc
+	cloudSyncLastRunDesc     *prometheus.Desc
+	cloudSyncLastSuccessDesc *prometheus.Desc
+	cloudSyncResultDesc      *prometheus.Desc
+	cloudSyncExportedDesc    *prometheus.Desc
+	cloudSyncEscrowedDesc    *prometheus.Desc
+
+	sectionSuccessDesc *prometheus.Desc
+
+	restClient      *rest.Client
+	graphRestClient *rest.Client
+	env             cloud.Environment
+
+	settings Settings
 }
 
-type entraIDServiceValue struct {
-	ServiceName string `json:"serviceName"`
-}
-
-type entraIDServices struct {
-	Value []entraIDServiceValue `json:"value"`
+type Settings struct {
+	// Concurrency is the number of sync services whose errors are queried in parallel.
+	Concurrency int
+	// ErrorDetails enables fetching the objects of each error bucket, see ErrorObjectsHandler.
+	ErrorDetails bool
+	// Now returns the current time for the sync age, time.Now if nil.
+	Now func() time.Time
 }
 
-type azureError struct {
-	Err struct {
-		Code    string `json:"code"`
-		Message string `json:"message"`
-	} `json:"error"`
-}
-
-func (a azureError) Error() string {
-	return fmt.Sprintf("%s %s", a.Err.Code, a.Err.Message)
+type entraIDServiceValue struct {
+	ServiceName string `json:"serviceName"`
 }
 
 type entraIDSyncError struct {
@@ -66,7 +94,7 @@ type entraIDSyncError struct {
 
 type entraIDServiceSyncErrors map[string][]entraIDSyncError
 
-func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, httpClient *http.Client) *Collector {
+func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, httpClient *http.Client, env cloud.Environment, settings Settings) *Collector {
 	return &Collector{
 		BaseCollector: abstract.NewBaseCollector(msGraphClient, subsystem),
 		logger:        logger.With(slog.String("collector", subsystem)),
@@ -87,6 +115,14 @@ func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.
 				"tenant": tenant,
 			},
 		),
+		syncAgeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "on_premises_sync_age_seconds"),
+			"seconds since the last azure ad connect synchronization, only for organizations with enabled synchronization",
+			[]string{"organization"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
 		errorDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(abstract.Namespace, subsystem, "on_premises_sync_error"),
 			"count of entra id connect synchronization errors",
@@ -95,7 +131,186 @@ func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.
 				"tenant": tenant,
 			},
 		),
-		httpClient: httpClient,
+		errorTruncatedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "on_premises_sync_error_truncated"),
+			"whether connect health truncated the count of entra id connect synchronization errors",
+			[]string{"sync_service", "error_bucket"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		errorObjectsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "on_premises_sync_error_objects"),
+			"count of objects with entra id connect synchronization errors by object type and attribute, if error details are enabled",
+			[]string{"sync_service", "error_bucket", "object_type", "attribute"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		serversDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "sync_servers"),
+			"number of enabled entra id connect servers of a sync service",
+			[]string{"sync_service"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		heartbeatDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "sync_server_last_heartbeat_date_time"),
+			"last Unix time an entra id connect server reported to connect health",
+			[]string{"sync_service", "server"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		lastExportDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "sync_server_last_export_date_time"),
+			"last Unix time an entra id connect server finished an export to entra id",
+			[]string{"sync_service", "server"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		serverInfoDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "sync_server_info"),
+			"version of entra id connect on a server",
+			[]string{"sync_service", "server", "version"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		alertsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "health_alerts"),
+			"number of active connect health alerts of a sync service",
+			[]string{"sync_service", "level"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		featureDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "feature_enabled"),
+			"status of a directory synchronization feature, e.g. passwordSync or deviceWriteback",
+			[]string{"organization", "feature"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		deletionPreventedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "accidental_deletion_prevention_enabled"),
+			"status of the prevention of accidental deletes by directory synchronization",
+			[]string{"organization"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		deletionThresholdDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "accidental_deletion_threshold"),
+			"number or percentage of deletes which stop directory synchronization",
+			[]string{"organization", "type"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		lastPasswordSyncDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "on_premises_last_password_sync_date_time"),
+			"last Unix time of password hash synchronization",
+			[]string{"organization"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		quotaUsedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "directory_size_quota_used"),
+			"number of directory objects counting towards the directory quota",
+			[]string{"organization"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		quotaTotalDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "directory_size_quota_total"),
+			"maximum number of directory objects of the organization",
+			[]string{"organization"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		cloudSyncStatusDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "cloud_sync_job_status"),
+			"status of an Entra Cloud Sync job, 1 for the current status",
+			[]string{"domain", "job_id", "template", "status"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		cloudSyncFailuresDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "cloud_sync_job_successive_failures"),
+			"number of successive failed cycles of an Entra Cloud Sync job",
+			[]string{"domain", "job_id", "template"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		cloudSyncQuarantineDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "cloud_sync_job_quarantine_info"),
+			"reason of a quarantined Entra Cloud Sync job",
+			[]string{"domain", "job_id", "template", "reason", "error_code"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		cloudSyncLastRunDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "cloud_sync_job_last_execution_date_time"),
+			"last Unix time an Entra Cloud Sync cycle ended, or began if it is running",
+			[]string{"domain", "job_id", "template"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		cloudSyncLastSuccessDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "cloud_sync_job_last_successful_execution_date_time"),
+			"last Unix time an Entra Cloud Sync cycle succeeded",
+			[]string{"domain", "job_id", "template"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		cloudSyncResultDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "cloud_sync_job_last_execution_result"),
+			"result of the last Entra Cloud Sync cycle, e.g. Succeeded or EntryLevelErrors",
+			[]string{"domain", "job_id", "template", "result"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		cloudSyncExportedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "cloud_sync_job_last_execution_exported_objects"),
+			"number of objects exported to Entra ID in the last cycle",
+			[]string{"domain", "job_id", "template"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		cloudSyncEscrowedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "cloud_sync_job_last_execution_escrowed_objects"),
+			"number of objects which failed in the last cycle and are retried",
+			[]string{"domain", "job_id", "template"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		sectionSuccessDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "section_success"),
+			"whether an optional section of the collector was scraped successfully",
+			[]string{"section"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		restClient:      rest.NewClient(httpClient, rest.Settings{Service: util.ServiceARM}),
+		graphRestClient: rest.NewClient(httpClient, rest.Settings{Service: util.ServiceGraph}),
+		env:             env,
+		settings:        settings,
 	}
 }
 
@@ -103,6 +318,16 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return slices.Concat(
+		abstract.GraphPermissions("Organization.Read.All"),
+		// the features and cloud sync sections report their errors by m365_adsync_section_success
+		abstract.OptionalGraphPermissions("OnPremDirectorySynchronization.Read.All", "Application.Read.All", "Synchronization.Read.All"),
+		// Entra ID Connect Health uses Azure RBAC, which is not part of the token roles
+		[]abstract.Permission{{Resource: abstract.ResourceARM, Name: "Microsoft.ADHybridHealthService/services/read"}},
+	)
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -110,13 +335,56 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 
 	ch <- c.lastSyncDesc
 
+	ch <- c.syncAgeDesc
+
 	ch <- c.errorDesc
+
+	ch <- c.errorTruncatedDesc
+
+	ch <- c.errorObjectsDesc
+
+	ch <- c.serversDesc
+
+	ch <- c.heartbeatDesc
+
+	ch <- c.lastExportDesc
+
+	ch <- c.serverInfoDesc
+
+	ch <- c.alertsDesc
+
+	ch <- c.featureDesc
+
+	ch <- c.deletionPreventedDesc
+
+	ch <- c.deletionThresholdDesc
+
+	ch <- c.lastPasswordSyncDesc
+
+	ch <- c.quotaUsedDesc
+
+	ch <- c.quotaTotalDesc
+
+	ch <- c.cloudSyncStatusDesc
+
+	ch <- c.cloudSyncFailuresDesc
+
+	ch <- c.cloudSyncQuarantineDesc
+
+	ch <- c.cloudSyncLastRunDesc
+
+	ch <- c.cloudSyncLastSuccessDesc
+
+	ch <- c.cloudSyncResultDesc
+
+	ch <- c.cloudSyncExportedDesc
+
+	ch <- c.cloudSyncEscrowedDesc
+
+	ch <- c.sectionSuccessDesc
 }
 
 func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, error) {
-	metrics := make([]prometheus.Metric, 0, 2)
-	errorMetrics := make([]prometheus.Metric, 0, 2)
-
 	queryParameters := organization.OrganizationRequestBuilderGetQueryParameters{
 		Select: []string{"onPremisesLastSyncDateTime", "onPremisesSyncEnabled", "id"},
 	}
@@ -126,57 +394,122 @@ func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, err
 
 	result, err := c.GraphClient().Organization().Get(ctx, &requestConfiguration)
 	if err != nil {
-		return nil, fmt.Errorf("error getting organizations: %w", err)
+		return nil, fmt.Errorf("error getting organizations: %w", util.GetOdataError(err))
 	}
 
-	for i, org := range result.GetValue() {
-		if i != 0 {
-			break
-		} // WARN: there can be multiple Sync status! Depending on how many <Organizations> tied to the tenant
+	now := time.Now
+	if c.settings.Now != nil {
+		now = c.settings.Now
+	}
+
+	metrics := make([]prometheus.Metric, 0, 3*len(result.GetValue()))
+	syncEnabled := false
 
-		azureAdSyncEnabledValue := 0
-		if *org.GetOnPremisesSyncEnabled() {
-			azureAdSyncEnabledValue = 1
+	for _, org := range result.GetValue() {
+		if org.GetId() == nil {
+			c.logger.WarnContext(ctx, "skipping organization without id")
 
-			errorMetrics, err = c.scrapeErrors(ctx)
-			if err != nil {
-				return nil, fmt.Errorf("error scraping Azure AD Sync Errors: %w", err)
-			}
+			continue
+		}
+
+		orgID := *org.GetId()
+
+		// onPremisesSyncEnabled is null for tenants which were never synchronized
+		enabled := org.GetOnPremisesSyncEnabled() != nil && *org.GetOnPremisesSyncEnabled()
+		if enabled {
+			syncEnabled = true
 		}
 
 		metrics = append(metrics, prometheus.MustNewConstMetric(
 			c.enabledDesc,
 			prometheus.GaugeValue,
-			float64(azureAdSyncEnabledValue),
-			*org.GetId(),
+			boolToFloat64(enabled),
+			orgID,
 		))
 
+		lastSync := org.GetOnPremisesLastSyncDateTime()
+		if lastSync == nil {
+			continue
+		}
+
 		metrics = append(metrics, prometheus.MustNewConstMetric(
 			c.lastSyncDesc,
 			prometheus.GaugeValue,
-			float64(org.GetOnPremisesLastSyncDateTime().Unix()),
-			*org.GetId(),
+			float64(lastSync.Unix()),
+			orgID,
 		))
+
+		// a tenant which stopped synchronizing keeps its last sync time, its age would only trigger alerts
+		if enabled {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.syncAgeDesc,
+				prometheus.GaugeValue,
+				now().Sub(*lastSync).Seconds(),
+				orgID,
+			))
+		}
 	}
 
-	return slices.Concat(metrics, errorMetrics), nil
-}
+	// Entra ID Connect Health services are shared by all organizations of the tenant
+	if !syncEnabled {
+		return metrics, nil
+	}
+
+	// the optional sections need further permissions, a missing one shouldn't discard the Connect metrics
+	sectionMetrics := make([]prometheus.Metric, 0)
+
+	for _, section := range []struct {
+		name   string
+		scrape func(ctx context.Context) ([]prometheus.Metric, error)
+	}{
+		{name: "features", scrape: c.scrapeSyncFeatures},
+		{name: "cloud_sync", scrape: c.scrapeCloudSync},
+	} {
+		scraped, err := section.scrape(ctx)
+		if err != nil {
+			c.logger.WarnContext(ctx, "failed to scrape section", slog.String("section", section.name), slog.Any("err", err))
+		}
+
+		sectionMetrics = append(sectionMetrics, scraped...)
+		sectionMetrics = append(sectionMetrics, prometheus.MustNewConstMetric(c.sectionSuccessDesc, prometheus.GaugeValue, boolToFloat64(err == nil), section.name))
+	}
 
-func (c *Collector) scrapeErrors(ctx context.Context) ([]prometheus.Metric, error) {
 	services, err := c.getSyncServices(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting Azure AD Sync Services: %w", err)
 	}
 
-	entraIDServiceSyncErrors := make(entraIDServiceSyncErrors)
+	errorMetrics, err := c.scrapeErrors(ctx, services)
+	if err != nil {
+		return nil, fmt.Errorf("error scraping Azure AD Sync Errors: %w", err)
+	}
+
+	healthMetrics, err := abstract.ForEach(ctx, c.settings.Concurrency, services, c.scrapeServiceHealth)
+	if err != nil {
+		return nil, fmt.Errorf("error scraping sync server health: %w", err)
+	}
 
-	for _, service := range services.Value {
-		syncErrors, err := c.getEntraServiceSyncErrors(ctx, service)
-		if err != nil {
-			return nil, fmt.Errorf("error getting errors: %w", err)
-		}
+	return slices.Concat(append([][]prometheus.Metric{metrics, sectionMetrics, errorMetrics}, healthMetrics...)...), nil
+}
+
+func boolToFloat64(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func (c *Collector) scrapeErrors(ctx context.Context, services []entraIDServiceValue) ([]prometheus.Metric, error) {
+	serviceSyncErrors, err := abstract.ForEach(ctx, c.settings.Concurrency, services, c.getEntraServiceSyncErrors)
+	if err != nil {
+		return nil, fmt.Errorf("error getting errors: %w", err)
+	}
 
-		entraIDServiceSyncErrors[service.ServiceName] = syncErrors
+	entraIDServiceSyncErrors := make(entraIDServiceSyncErrors, len(services))
+
+	for i, service := range services {
+		entraIDServiceSyncErrors[service.ServiceName] = serviceSyncErrors[i]
 	}
 
 	metrics := make([]prometheus.Metric, 0, 2)
@@ -189,98 +522,46 @@ func (c *Collector) scrapeErrors(ctx context.Context) ([]prometheus.Metric, erro
 				float64(syncError.Count),
 				serviceName,
 				syncError.ErrorBucket,
+			), prometheus.MustNewConstMetric(
+				c.errorTruncatedDesc,
+				prometheus.GaugeValue,
+				boolToFloat64(syncError.Truncated),
+				serviceName,
+				syncError.ErrorBucket,
 			))
 		}
 	}
 
-	return metrics, nil
-}
-
-func (c *Collector) getSyncServices(ctx context.Context) (entraIDServices, error) {
-	var services entraIDServices
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, URLAllServicesADSyncErrors, nil)
-	if err != nil {
-		return services, fmt.Errorf("error creating request: %w", err)
+	if !c.settings.ErrorDetails {
+		return metrics, nil
 	}
 
-	resp, err := c.httpClient.Do(req)
+	// the error counts don't depend on the details, the objects of the last successful scrape are kept on errors
+	objectMetrics, err := c.scrapeErrorObjects(ctx, entraIDServiceSyncErrors)
 	if err != nil {
-		return services, fmt.Errorf("error sending request: %w", err)
+		c.logger.WarnContext(ctx, "failed to scrape section", slog.String("section", "error_details"), slog.Any("err", err))
 	}
 
-	defer func() {
-		err := resp.Body.Close()
-		if err != nil {
-			c.logger.ErrorContext(ctx, "error closing response body", slog.Any("err", err))
-		}
-	}()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return services, fmt.Errorf("error reading response body: %w", err)
-	}
+	metrics = append(metrics, objectMetrics...)
 
-	if resp.StatusCode != http.StatusOK {
-		var azureError azureError
-
-		err = json.Unmarshal(body, &azureError)
-		if err != nil {
-			return services, fmt.Errorf("error unmarshalling response (status %d): %s", resp.StatusCode, body)
-		}
-
-		return services, fmt.Errorf("unexpected status code %d: %w", resp.StatusCode, azureError)
-	}
+	return append(metrics, prometheus.MustNewConstMetric(c.sectionSuccessDesc, prometheus.GaugeValue, boolToFloat64(err == nil), "error_details")), nil
+}
 
-	err = json.Unmarshal(body, &services)
+func (c *Collector) getSyncServices(ctx context.Context) ([]entraIDServiceValue, error) {
+	services, err := rest.GetAll[entraIDServiceValue](ctx, c.restClient, c.env.ARMEndpoint+PathAllServicesADSyncErrors)
 	if err != nil {
-		return services, fmt.Errorf("error unmarshalling response: body %s, error %w", body, err)
+		return nil, fmt.Errorf("failed to get sync services: %w", err)
 	}
 
 	return services, nil
 }
 
 func (c *Collector) getEntraServiceSyncErrors(ctx context.Context, service entraIDServiceValue) ([]entraIDSyncError, error) {
-	url := fmt.Sprintf(URLServiceADSyncError, service.ServiceName)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
-	}
-
-	defer func() {
-		err := resp.Body.Close()
-		if err != nil {
-			c.logger.ErrorContext(ctx, "error closing response body", slog.Any("err", err))
-		}
-	}()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		var azureError azureError
-
-		err = json.Unmarshal(body, &azureError)
-		if err != nil {
-			return nil, fmt.Errorf("error unmarshalling response (status %d): %s", resp.StatusCode, body)
-		}
-
-		return nil, fmt.Errorf("unexpected status code %d: %w", resp.StatusCode, azureError)
-	}
-
-	var entraIDSyncErrors []entraIDSyncError
+	url := c.env.ARMEndpoint + fmt.Sprintf(PathServiceADSyncError, service.ServiceName)
 
-	err = json.Unmarshal(body, &entraIDSyncErrors)
+	entraIDSyncErrors, err := rest.GetJSON[[]entraIDSyncError](ctx, c.restClient, url)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling response: body %s, error %w", body, err)
+		return nil, fmt.Errorf("failed to get sync errors of %s: %w", service.ServiceName, err)
 	}
 
 	if entraIDSyncErrors == nil {
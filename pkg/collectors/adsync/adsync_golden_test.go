@@ -0,0 +1,116 @@
+package adsync_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/adsync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector_ScrapeMetrics_Golden(t *testing.T) {
+	t.Parallel()
+
+	now := func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	testutil.RunGolden(t, []testutil.GoldenCase[adsync.Settings]{
+		{Name: "sync_enabled", Settings: adsync.Settings{Now: now}},
+		{Name: "cloud_only", Settings: adsync.Settings{Now: now}},
+		{Name: "multiple_organizations", Settings: adsync.Settings{Now: now}},
+		{Name: "features_failed", Settings: adsync.Settings{Now: now}},
+		{Name: "cloud_sync", Settings: adsync.Settings{Now: now}},
+		{Name: "cloud_sync_forbidden", Settings: adsync.Settings{Now: now}},
+		{Name: "cloud_sync_failed", Settings: adsync.Settings{Now: now}},
+		{Name: "error_details", Settings: adsync.Settings{ErrorDetails: true, Now: now}},
+		{Name: "error_details_failed", Settings: adsync.Settings{ErrorDetails: true, Now: now}},
+		{Name: "service_error", Settings: adsync.Settings{Now: now}, WantErr: true},
+	}, func(tb testing.TB, logger *slog.Logger, server *fakegraph.Server, settings adsync.Settings) testutil.Scraper {
+		return adsync.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(tb), server.Client(), server.Environment(), settings)
+	})
+}
+
+func TestCollector_ErrorObjectsHandler(t *testing.T) {
+	t.Parallel()
+
+	// TODO: Go 1.24: Change to slog.NewDiscardHandler
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server := fakegraph.New(t)
+	server.Load(t, filepath.Join("testdata", "error_details.json"))
+
+	collector := adsync.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(t), server.Client(), server.Environment(), adsync.Settings{
+		ErrorDetails: true,
+	})
+
+	var response struct {
+		Updated *time.Time               `json:"updated"`
+		Objects []adsync.SyncErrorObject `json:"objects"`
+	}
+
+	const token = "s3cr3t"
+
+	handler := collector.ErrorObjectsHandler(token)
+
+	for _, authorization := range []string{"", "Bearer wrong", "Basic czNjcjN0"} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/adsync/errors", nil)
+		request.Header.Set("Authorization", authorization)
+
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, authorization)
+		assert.NotContains(t, recorder.Body.String(), "objects")
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/adsync/errors", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Nil(t, response.Updated, "nothing was scraped yet")
+	assert.Empty(t, response.Objects)
+
+	// TODO: Go 1.24: Change to t.Context()
+	_, err := collector.ScrapeMetrics(context.Background())
+	require.NoError(t, err)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.NotNil(t, response.Updated)
+	assert.Len(t, response.Objects, 4)
+	assert.Contains(t, response.Objects, adsync.SyncErrorObject{
+		SyncService:       "AadSyncService-fabrikam.onmicrosoft.com",
+		ErrorBucket:       "DuplicateAttribute",
+		ErrorType:         "AttributeValueMustBeUnique",
+		ObjectType:        "User",
+		DisplayName:       "Carol",
+		UserPrincipalName: "carol@fabrikam.com",
+		AttributeName:     "UserPrincipalName",
+		AttributeValue:    "carol@fabrikam.com",
+	})
+
+	// a failing bucket keeps the objects of the last successful scrape
+	server.Handle(http.MethodGet, "/providers/Microsoft.ADHybridHealthService/services/AadSyncService-contoso.onmicrosoft.com/exporterrors/listV2",
+		fakegraph.Response{Status: http.StatusInternalServerError})
+
+	// TODO: Go 1.24: Change to t.Context()
+	_, err = collector.ScrapeMetrics(context.Background())
+	require.NoError(t, err)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Len(t, response.Objects, 4)
+}
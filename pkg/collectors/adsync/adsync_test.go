@@ -10,6 +10,7 @@ import (
 
 	"github.com/cloudeteer/m365-exporter/internal/testutil"
 	"github.com/cloudeteer/m365-exporter/pkg/auth"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/adsync"
 	"github.com/cloudeteer/m365-exporter/pkg/httpclient"
 	"github.com/prometheus/client_golang/prometheus"
@@ -33,13 +34,13 @@ func TestCollector_ScrapeMetrics(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
 	// TODO: make this a singleton for all tests
-	msGraphClient, azureCredential, err := auth.NewMSGraphClient(http.DefaultClient)
+	msGraphClient, azureCredential, err := auth.NewMSGraphClient(http.DefaultClient, cloud.AzurePublic, auth.Settings{})
 	require.NoError(t, err)
 
-	httpClient := httpclient.New(prometheus.NewRegistry())
-	httpClient.WithAzureCredential(azureCredential)
+	httpClient := httpclient.New(prometheus.NewRegistry(), httpclient.Settings{})
+	httpClient.WithAzureCredential(azureCredential, cloud.AzurePublic)
 
-	collector := adsync.NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient())
+	collector := adsync.NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient(), cloud.AzurePublic, adsync.Settings{})
 
 	// TODO: Go 1.24: Change to t.Context()
 	metrics, err := collector.ScrapeMetrics(context.TODO())
@@ -54,3 +55,23 @@ func TestCollector_ScrapeMetrics(t *testing.T) {
 	assert.Contains(t, allMetrics, "m365_adsync_on_premises_last_sync_date_time")
 	assert.Contains(t, allMetrics, "m365_adsync_on_premises_sync_enabled")
 }
+
+func TestCollector_RequiredPermissions(t *testing.T) {
+	t.Parallel()
+
+	// TODO: Go 1.24: Change to slog.NewDiscardHandler
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	collector := adsync.NewCollector(logger, "contoso.onmicrosoft.com", nil, http.DefaultClient, cloud.AzurePublic, adsync.Settings{})
+
+	required := make([]string, 0)
+
+	for _, permission := range collector.RequiredPermissions() {
+		if !permission.Optional {
+			required = append(required, permission.Name)
+		}
+	}
+
+	// the permissions of the optional sections must not disable the collector
+	assert.ElementsMatch(t, []string{"Organization.Read.All", "Microsoft.ADHybridHealthService/services/read"}, required)
+}
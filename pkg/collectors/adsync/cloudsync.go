@@ -0,0 +1,200 @@
+package adsync
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/util"
+	graphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/serviceprincipals"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cloudSyncFilter selects the service principals created from the Entra Cloud Sync (AD2AAD) application template, one
+// per configured Active Directory domain.
+const cloudSyncFilter = "applicationTemplateId eq '1a4721b3-e57f-4451-ae87-ef078703ec94'"
+
+// jobStatusCodes are the codes of synchronization jobs, all of them are reported to allow alerting on a change.
+var jobStatusCodes = []string{"NotConfigured", "NotRun", "Active", "Paused", "Quarantine"}
+
+// scrapeCloudSync returns the job metrics of Entra Cloud Sync, which is invisible to Connect Health.
+func (c *Collector) scrapeCloudSync(ctx context.Context) ([]prometheus.Metric, error) {
+	servicePrincipals, err := c.getCloudSyncServicePrincipals(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cloud sync service principals: %w", err)
+	}
+
+	jobMetrics, err := abstract.ForEach(ctx, c.settings.Concurrency, servicePrincipals, c.scrapeSynchronizationJobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cloud sync jobs: %w", err)
+	}
+
+	return slices.Concat(jobMetrics...), nil
+}
+
+func (c *Collector) getCloudSyncServicePrincipals(ctx context.Context) ([]models.ServicePrincipalable, error) {
+	filter := cloudSyncFilter
+	request := &serviceprincipals.ServicePrincipalsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &serviceprincipals.ServicePrincipalsRequestBuilderGetQueryParameters{
+			Select: []string{"id", "displayName"},
+			Filter: &filter,
+		},
+	}
+
+	result, err := c.GraphClient().ServicePrincipals().Get(ctx, request)
+	if err != nil {
+		return nil, util.GetOdataError(err)
+	}
+
+	iterator, err := graphcore.NewPageIterator[models.ServicePrincipalable](
+		result,
+		c.GraphClient().GetAdapter(),
+		models.CreateServicePrincipalCollectionResponseFromDiscriminatorValue,
+	)
+	if err != nil {
+		return nil, util.GetOdataError(err)
+	}
+
+	servicePrincipals := make([]models.ServicePrincipalable, 0)
+
+	err = iterator.Iterate(ctx, func(servicePrincipal models.ServicePrincipalable) bool {
+		if servicePrincipal.GetId() != nil {
+			servicePrincipals = append(servicePrincipals, servicePrincipal)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, util.GetOdataError(err)
+	}
+
+	return servicePrincipals, nil
+}
+
+func (c *Collector) getSynchronizationJobs(ctx context.Context, servicePrincipalID string) ([]models.SynchronizationJobable, error) {
+	result, err := c.GraphClient().ServicePrincipals().ByServicePrincipalId(servicePrincipalID).Synchronization().Jobs().Get(ctx, nil)
+	if err != nil {
+		return nil, util.GetOdataError(err)
+	}
+
+	iterator, err := graphcore.NewPageIterator[models.SynchronizationJobable](
+		result,
+		c.GraphClient().GetAdapter(),
+		models.CreateSynchronizationJobCollectionResponseFromDiscriminatorValue,
+	)
+	if err != nil {
+		return nil, util.GetOdataError(err)
+	}
+
+	jobs := make([]models.SynchronizationJobable, 0)
+
+	err = iterator.Iterate(ctx, func(job models.SynchronizationJobable) bool {
+		if job.GetStatus() != nil {
+			jobs = append(jobs, job)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, util.GetOdataError(err)
+	}
+
+	return jobs, nil
+}
+
+func (c *Collector) scrapeSynchronizationJobs(ctx context.Context, servicePrincipal models.ServicePrincipalable) ([]prometheus.Metric, error) {
+	displayName := deref(servicePrincipal.GetDisplayName())
+
+	jobs, err := c.getSynchronizationJobs(ctx, *servicePrincipal.GetId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get synchronization jobs of %s: %w", displayName, err)
+	}
+
+	metrics := make([]prometheus.Metric, 0, 16*len(jobs))
+
+	for _, job := range jobs {
+		status := job.GetStatus()
+		labels := []string{displayName, deref(job.GetId()), deref(job.GetTemplateId())}
+
+		for _, code := range jobStatusCodes {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.cloudSyncStatusDesc,
+				prometheus.GaugeValue,
+				boolToFloat64(util.EnumString(status.GetCode()) == code),
+				append(labels, code)...,
+			))
+		}
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.cloudSyncFailuresDesc,
+			prometheus.GaugeValue,
+			float64(deref(status.GetCountSuccessiveCompleteFailures())),
+			labels...,
+		))
+
+		if quarantine := status.GetQuarantine(); quarantine != nil {
+			errorCode := ""
+			if quarantine.GetError() != nil {
+				errorCode = deref(quarantine.GetError().GetCode())
+			}
+
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.cloudSyncQuarantineDesc,
+				prometheus.GaugeValue,
+				1,
+				append(labels, util.EnumString(quarantine.GetReason()), errorCode)...,
+			))
+		}
+
+		if execution := status.GetLastSuccessfulExecution(); execution != nil && execution.GetTimeEnded() != nil {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.cloudSyncLastSuccessDesc,
+				prometheus.GaugeValue,
+				float64(execution.GetTimeEnded().Unix()),
+				labels...,
+			))
+		}
+
+		execution := status.GetLastExecution()
+		if execution == nil {
+			continue
+		}
+
+		// a running cycle has no end yet
+		lastRun := execution.GetTimeEnded()
+		if lastRun == nil {
+			lastRun = execution.GetTimeBegan()
+		}
+
+		if lastRun != nil {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.cloudSyncLastRunDesc,
+				prometheus.GaugeValue,
+				float64(lastRun.Unix()),
+				labels...,
+			))
+		}
+
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(c.cloudSyncResultDesc, prometheus.GaugeValue, 1, append(labels, util.EnumString(execution.GetState()))...),
+			prometheus.MustNewConstMetric(c.cloudSyncExportedDesc, prometheus.GaugeValue, float64(deref(execution.GetCountExported())), labels...),
+			prometheus.MustNewConstMetric(c.cloudSyncEscrowedDesc, prometheus.GaugeValue, float64(deref(execution.GetCountEscrowed())), labels...),
+		)
+	}
+
+	return metrics, nil
+}
+
+// deref returns the value of p, or the zero value if p is nil.
+func deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+
+		return zero
+	}
+
+	return *p
+}
@@ -0,0 +1,192 @@
+package adsync
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const PathServiceExportErrors = "/providers/Microsoft.ADHybridHealthService/services/%s/exporterrors/listV2?api-version=2014-01-01&errorBucket=%s"
+
+// exportError is an object which failed to synchronize, as returned by connect health.
+type exportError struct {
+	Type                      string     `json:"type"`
+	IncomingObjectType        string     `json:"incomingObjectType"`
+	IncomingObjectDisplayName string     `json:"incomingObjectDisplayName"`
+	IncomingUserPrincipalName string     `json:"incomingUserPrincipalName"`
+	AttributeName             string     `json:"attributeName"`
+	AttributeValue            string     `json:"attributeValue"`
+	ExistingObjectType        string     `json:"existingObjectType"`
+	ExistingObjectDisplayName string     `json:"existingObjectDisplayName"`
+	ExistingUserPrincipalName string     `json:"existingUserPrincipalName"`
+	TimeFirstOccurred         *time.Time `json:"timeFirstOccurred"`
+}
+
+// SyncErrorObject is an object which failed to synchronize, as served by ErrorObjectsHandler.
+type SyncErrorObject struct {
+	SyncService               string     `json:"syncService"`
+	ErrorBucket               string     `json:"errorBucket"`
+	ErrorType                 string     `json:"errorType"`
+	ObjectType                string     `json:"objectType"`
+	DisplayName               string     `json:"displayName"`
+	UserPrincipalName         string     `json:"userPrincipalName,omitempty"`
+	AttributeName             string     `json:"attributeName,omitempty"`
+	AttributeValue            string     `json:"attributeValue,omitempty"`
+	ExistingObjectType        string     `json:"existingObjectType,omitempty"`
+	ExistingObjectDisplayName string     `json:"existingObjectDisplayName,omitempty"`
+	ExistingUserPrincipalName string     `json:"existingUserPrincipalName,omitempty"`
+	FirstOccurred             *time.Time `json:"firstOccurred,omitempty"`
+}
+
+// errorObjectStore keeps the objects of the last successful scrape for ErrorObjectsHandler.
+type errorObjectStore struct {
+	mu      sync.RWMutex
+	updated time.Time
+	objects []SyncErrorObject
+}
+
+type errorBucket struct {
+	service string
+	bucket  string
+}
+
+// scrapeErrorObjects fetches the objects of each non-empty error bucket and counts them by object type and attribute.
+// Both are bounded by the directory schema, unlike the objects themselves, which are only served as JSON.
+func (c *Collector) scrapeErrorObjects(ctx context.Context, serviceSyncErrors entraIDServiceSyncErrors) ([]prometheus.Metric, error) {
+	buckets := make([]errorBucket, 0, len(serviceSyncErrors))
+
+	for service, syncErrors := range serviceSyncErrors {
+		for _, syncError := range syncErrors {
+			if syncError.Count > 0 {
+				buckets = append(buckets, errorBucket{service: service, bucket: syncError.ErrorBucket})
+			}
+		}
+	}
+
+	bucketObjects, err := abstract.ForEach(ctx, c.settings.Concurrency, buckets, c.getErrorObjects)
+	if err != nil {
+		return nil, fmt.Errorf("error getting error details: %w", err)
+	}
+
+	type objectKey struct {
+		errorBucket
+		objectType string
+		attribute  string
+	}
+
+	counts := make(map[objectKey]int)
+	objects := make([]SyncErrorObject, 0)
+
+	for _, bucketObjects := range bucketObjects {
+		for _, object := range bucketObjects {
+			counts[objectKey{
+				errorBucket: errorBucket{service: object.SyncService, bucket: object.ErrorBucket},
+				objectType:  object.ObjectType,
+				attribute:   object.AttributeName,
+			}]++
+		}
+
+		objects = append(objects, bucketObjects...)
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(counts))
+
+	for key, count := range counts {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.errorObjectsDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			key.service,
+			key.bucket,
+			key.objectType,
+			key.attribute,
+		))
+	}
+
+	c.errorObjects.mu.Lock()
+	c.errorObjects.updated = time.Now()
+	c.errorObjects.objects = objects
+	c.errorObjects.mu.Unlock()
+
+	return metrics, nil
+}
+
+func (c *Collector) getErrorObjects(ctx context.Context, bucket errorBucket) ([]SyncErrorObject, error) {
+	path := fmt.Sprintf(PathServiceExportErrors, bucket.service, url.QueryEscape(bucket.bucket))
+
+	exportErrors, err := rest.GetAll[exportError](ctx, c.restClient, c.env.ARMEndpoint+path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s errors of %s: %w", bucket.bucket, bucket.service, err)
+	}
+
+	objects := make([]SyncErrorObject, 0, len(exportErrors))
+
+	for _, exportError := range exportErrors {
+		objects = append(objects, SyncErrorObject{
+			SyncService:               bucket.service,
+			ErrorBucket:               bucket.bucket,
+			ErrorType:                 exportError.Type,
+			ObjectType:                exportError.IncomingObjectType,
+			DisplayName:               exportError.IncomingObjectDisplayName,
+			UserPrincipalName:         exportError.IncomingUserPrincipalName,
+			AttributeName:             exportError.AttributeName,
+			AttributeValue:            exportError.AttributeValue,
+			ExistingObjectType:        exportError.ExistingObjectType,
+			ExistingObjectDisplayName: exportError.ExistingObjectDisplayName,
+			ExistingUserPrincipalName: exportError.ExistingUserPrincipalName,
+			FirstOccurred:             exportError.TimeFirstOccurred,
+		})
+	}
+
+	return objects, nil
+}
+
+// ErrorObjectsHandler serves the objects with synchronization errors of the last scrape as JSON. The response
+// contains names and UPNs, so only requests with the bearer token are answered. An empty token rejects all requests.
+func (c *Collector) ErrorObjectsHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="adsync"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		c.errorObjects.mu.RLock()
+		defer c.errorObjects.mu.RUnlock()
+
+		response := struct {
+			Updated *time.Time        `json:"updated"`
+			Objects []SyncErrorObject `json:"objects"`
+		}{
+			Objects: c.errorObjects.objects,
+		}
+
+		if !c.errorObjects.updated.IsZero() {
+			response.Updated = &c.errorObjects.updated
+		}
+
+		if response.Objects == nil {
+			response.Objects = []SyncErrorObject{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		err := json.NewEncoder(w).Encode(response)
+		if err != nil {
+			c.logger.ErrorContext(r.Context(), "failed to write sync error objects", slog.Any("err", err))
+		}
+	})
+}
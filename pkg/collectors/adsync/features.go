@@ -0,0 +1,125 @@
+package adsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	PathOnPremisesSynchronization = "/beta/directory/onPremisesSynchronization"
+	PathOrganizationSync          = "/beta/organization?$select=id,onPremisesLastPasswordSyncDateTime,directorySizeQuota"
+)
+
+// deletionPreventionDisabled is the synchronizationPreventionType of disabled accidental-delete protection.
+const deletionPreventionDisabled = "disabled"
+
+type onPremisesSynchronization struct {
+	ID            string `json:"id"`
+	Configuration struct {
+		AccidentalDeletionPrevention *struct {
+			SynchronizationPreventionType string `json:"synchronizationPreventionType"`
+			AlertThreshold                *int   `json:"alertThreshold"`
+		} `json:"accidentalDeletionPrevention"`
+	} `json:"configuration"`
+	// Features maps e.g. passwordSyncEnabled to its status. New features are reported without code changes.
+	Features map[string]any `json:"features"`
+}
+
+type organizationSync struct {
+	ID                                 string     `json:"id"`
+	OnPremisesLastPasswordSyncDateTime *time.Time `json:"onPremisesLastPasswordSyncDateTime"`
+	DirectorySizeQuota                 *struct {
+		Used  int `json:"used"`
+		Total int `json:"total"`
+	} `json:"directorySizeQuota"`
+}
+
+// scrapeSyncFeatures returns the synchronization feature, accidental-delete protection, password sync and
+// directory quota metrics. These are only available in the beta API. If the synchronization features fail, e.g.
+// because OnPremDirectorySynchronization.Read.All is missing, the metrics of the organization are still returned.
+func (c *Collector) scrapeSyncFeatures(ctx context.Context) ([]prometheus.Metric, error) {
+	syncs, syncErr := rest.GetAll[onPremisesSynchronization](ctx, c.graphRestClient, c.env.GraphEndpoint+PathOnPremisesSynchronization)
+	if syncErr != nil {
+		syncErr = fmt.Errorf("failed to get directory synchronization: %w", syncErr)
+	}
+
+	orgs, err := rest.GetAll[organizationSync](ctx, c.graphRestClient, c.env.GraphEndpoint+PathOrganizationSync)
+	if err != nil {
+		return nil, errors.Join(syncErr, fmt.Errorf("failed to get organization: %w", err))
+	}
+
+	metrics := make([]prometheus.Metric, 0, 32)
+
+	for _, sync := range syncs {
+		metrics = append(metrics, c.featureMetrics(sync)...)
+	}
+
+	for _, org := range orgs {
+		if org.OnPremisesLastPasswordSyncDateTime != nil {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.lastPasswordSyncDesc,
+				prometheus.GaugeValue,
+				float64(org.OnPremisesLastPasswordSyncDateTime.Unix()),
+				org.ID,
+			))
+		}
+
+		if quota := org.DirectorySizeQuota; quota != nil {
+			metrics = append(metrics,
+				prometheus.MustNewConstMetric(c.quotaUsedDesc, prometheus.GaugeValue, float64(quota.Used), org.ID),
+				prometheus.MustNewConstMetric(c.quotaTotalDesc, prometheus.GaugeValue, float64(quota.Total), org.ID),
+			)
+		}
+	}
+
+	return metrics, syncErr
+}
+
+func (c *Collector) featureMetrics(sync onPremisesSynchronization) []prometheus.Metric {
+	metrics := make([]prometheus.Metric, 0, len(sync.Features)+2)
+
+	for key, value := range sync.Features {
+		enabled, ok := value.(bool)
+		if !ok || !strings.HasSuffix(key, "Enabled") {
+			continue
+		}
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.featureDesc,
+			prometheus.GaugeValue,
+			boolToFloat64(enabled),
+			sync.ID,
+			strings.TrimSuffix(key, "Enabled"),
+		))
+	}
+
+	prevention := sync.Configuration.AccidentalDeletionPrevention
+	if prevention == nil {
+		return metrics
+	}
+
+	metrics = append(metrics, prometheus.MustNewConstMetric(
+		c.deletionPreventedDesc,
+		prometheus.GaugeValue,
+		boolToFloat64(prevention.SynchronizationPreventionType != deletionPreventionDisabled),
+		sync.ID,
+	))
+
+	if prevention.SynchronizationPreventionType != deletionPreventionDisabled && prevention.AlertThreshold != nil {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.deletionThresholdDesc,
+			prometheus.GaugeValue,
+			float64(*prevention.AlertThreshold),
+			sync.ID,
+			prevention.SynchronizationPreventionType,
+		))
+	}
+
+	return metrics
+}
@@ -0,0 +1,185 @@
+package adsync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	PathServiceMembers       = "/providers/Microsoft.ADHybridHealthService/services/%s/servicemembers?api-version=2014-01-01"
+	PathServiceAlerts        = "/providers/Microsoft.ADHybridHealthService/services/%s/alerts?api-version=2014-01-01"
+	PathServiceExportStatus  = "/providers/Microsoft.ADHybridHealthService/services/%s/exportstatus?api-version=2014-01-01"
+	PathServiceConfiguration = "/providers/Microsoft.ADHybridHealthService/services/%s/servicemembers/%s/serviceconfiguration?api-version=2014-01-01"
+)
+
+// alertLevels are the levels of connect health alerts, they are reported with 0 if there is no active alert.
+var alertLevels = []string{"Error", "Warning", "PreWarning"}
+
+// serviceMember is an entra id connect server of a sync service.
+type serviceMember struct {
+	ServiceMemberID string `json:"serviceMemberId"`
+	MachineName     string `json:"machineName"`
+	Disabled        bool   `json:"disabled"`
+	// LastUpdated is the last time the health agent reported.
+	LastUpdated *time.Time `json:"lastUpdated"`
+}
+
+// serviceConfiguration is the configuration of an entra id connect server.
+type serviceConfiguration struct {
+	// Version is the version of entra id connect.
+	Version string `json:"version"`
+}
+
+type healthAlert struct {
+	Level string `json:"level"`
+	State string `json:"state"`
+}
+
+// exportStatus is an export run of a server to entra id. Connect Health neither exposes the connector nor the result
+// of a run, nor import runs.
+type exportStatus struct {
+	ServiceMemberID string     `json:"serviceMemberId"`
+	EndTime         *time.Time `json:"endTime"`
+}
+
+// syncServer is an enabled entra id connect server. A server registered more than once, e.g. after a reinstallation,
+// has a service member per registration, they are merged by machine name.
+type syncServer struct {
+	lastHeartbeat time.Time
+	lastExport    time.Time
+	// version is the version of the most recently updated service member.
+	version   string
+	updatedAt time.Time
+}
+
+// scrapeServiceHealth returns the server, heartbeat, version, export and alert metrics of a sync service.
+func (c *Collector) scrapeServiceHealth(ctx context.Context, service entraIDServiceValue) ([]prometheus.Metric, error) {
+	members, err := rest.GetAll[serviceMember](ctx, c.restClient, c.env.ARMEndpoint+fmt.Sprintf(PathServiceMembers, service.ServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get servers of %s: %w", service.ServiceName, err)
+	}
+
+	alerts, err := rest.GetAll[healthAlert](ctx, c.restClient, c.env.ARMEndpoint+fmt.Sprintf(PathServiceAlerts, service.ServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alerts of %s: %w", service.ServiceName, err)
+	}
+
+	exports, err := rest.GetAll[exportStatus](ctx, c.restClient, c.env.ARMEndpoint+fmt.Sprintf(PathServiceExportStatus, service.ServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export status of %s: %w", service.ServiceName, err)
+	}
+
+	servers := make(map[string]*syncServer, len(members))
+	// machineNames maps the ids of enabled service members to their server.
+	machineNames := make(map[string]string, len(members))
+
+	for _, member := range members {
+		if member.Disabled {
+			continue
+		}
+
+		config, err := rest.GetJSON[serviceConfiguration](ctx, c.restClient, c.env.ARMEndpoint+fmt.Sprintf(PathServiceConfiguration, service.ServiceName, member.ServiceMemberID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get configuration of %s: %w", member.MachineName, err)
+		}
+
+		machineNames[member.ServiceMemberID] = member.MachineName
+
+		server, ok := servers[member.MachineName]
+		if !ok {
+			server = &syncServer{}
+			servers[member.MachineName] = server
+		}
+
+		var lastUpdated time.Time
+		if member.LastUpdated != nil {
+			lastUpdated = *member.LastUpdated
+		}
+
+		if lastUpdated.After(server.lastHeartbeat) {
+			server.lastHeartbeat = lastUpdated
+		}
+
+		if !ok || lastUpdated.After(server.updatedAt) {
+			server.version = config.Version
+			server.updatedAt = lastUpdated
+		}
+	}
+
+	for _, export := range exports {
+		machineName, ok := machineNames[export.ServiceMemberID]
+		if !ok || export.EndTime == nil {
+			continue
+		}
+
+		if server := servers[machineName]; export.EndTime.After(server.lastExport) {
+			server.lastExport = *export.EndTime
+		}
+	}
+
+	metrics := make([]prometheus.Metric, 0, 1+3*len(servers)+len(alertLevels))
+
+	metrics = append(metrics, prometheus.MustNewConstMetric(
+		c.serversDesc,
+		prometheus.GaugeValue,
+		float64(len(servers)),
+		service.ServiceName,
+	))
+
+	for machineName, server := range servers {
+		if !server.lastHeartbeat.IsZero() {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.heartbeatDesc,
+				prometheus.GaugeValue,
+				float64(server.lastHeartbeat.Unix()),
+				service.ServiceName,
+				machineName,
+			))
+		}
+
+		if !server.lastExport.IsZero() {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.lastExportDesc,
+				prometheus.GaugeValue,
+				float64(server.lastExport.Unix()),
+				service.ServiceName,
+				machineName,
+			))
+		}
+
+		if server.version != "" {
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				c.serverInfoDesc,
+				prometheus.GaugeValue,
+				1,
+				service.ServiceName,
+				machineName,
+				server.version,
+			))
+		}
+	}
+
+	activeAlerts := make(map[string]int, len(alertLevels))
+
+	for _, alert := range alerts {
+		if alert.State == "Active" {
+			activeAlerts[alert.Level]++
+		}
+	}
+
+	for _, level := range alertLevels {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.alertsDesc,
+			prometheus.GaugeValue,
+			float64(activeAlerts[level]),
+			service.ServiceName,
+			level,
+		))
+	}
+
+	return metrics, nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/util"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	graphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
 	"github.com/microsoftgraph/msgraph-sdk-go/applications"
@@ -63,6 +64,10 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return abstract.GraphPermissions("Application.Read.All")
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -83,7 +88,7 @@ func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, err
 
 	appsRequest, err := c.GraphClient().Applications().Get(ctx, request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch application: %w", err)
+		return nil, fmt.Errorf("failed to fetch application: %w", util.GetOdataError(err))
 	}
 
 	appIterator, err := graphcore.NewPageIterator[*models.Application](
@@ -92,7 +97,7 @@ func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, err
 		models.CreateApplicationCollectionResponseFromDiscriminatorValue,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create page iterator: %w", err)
+		return nil, fmt.Errorf("failed to create page iterator: %w", util.GetOdataError(err))
 	}
 
 	metrics, err := c.iterateThroughApplications(ctx, appIterator)
@@ -137,7 +142,7 @@ func (c *Collector) iterateThroughApplications(ctx context.Context, iterator *gr
 				var secretName string
 				if cred.GetDisplayName() != nil {
 					secretName = *cred.GetDisplayName()
-				} else {
+				} else if len(keyID) >= 8 {
 					secretName = keyID[:8] // Use first 8 chars of keyID as fallback
 				}
 
@@ -173,7 +178,7 @@ func (c *Collector) iterateThroughApplications(ctx context.Context, iterator *gr
 		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to iterate through application: %w", err)
+		return nil, fmt.Errorf("failed to iterate through application: %w", util.GetOdataError(err))
 	}
 
 	return metrics, nil
@@ -0,0 +1,22 @@
+package application_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/application"
+)
+
+func TestCollector_ScrapeMetrics_Golden(t *testing.T) {
+	t.Parallel()
+
+	testutil.RunGolden(t, []testutil.GoldenCase[struct{}]{
+		{Name: "default"},
+		{Name: "nil_fields"},
+		{Name: "forbidden", WantErr: true},
+	}, func(tb testing.TB, logger *slog.Logger, server *fakegraph.Server, _ struct{}) testutil.Scraper {
+		return application.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(tb), application.Settings{})
+	})
+}
@@ -50,6 +50,10 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return abstract.GraphPermissions("User.Read.All")
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -0,0 +1,49 @@
+package entraid_test
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/entraid"
+)
+
+func TestCollector_ScrapeMetrics_Golden(t *testing.T) {
+	t.Parallel()
+
+	// Settings maps the $filter of a user count request to the count, other filters are answered with 403.
+	testutil.RunGolden(t, []testutil.GoldenCase[map[string]int]{
+		{
+			Name: "default",
+			Settings: map[string]int{
+				"accountEnabled eq true and userType eq 'Member'":  120,
+				"accountEnabled eq false and userType eq 'Member'": 7,
+				"accountEnabled eq true and userType eq 'Guest'":   15,
+				"accountEnabled eq false and userType eq 'Guest'":  0,
+			},
+		},
+		{
+			Name: "partial_failure",
+			Settings: map[string]int{
+				"accountEnabled eq true and userType eq 'Member'":  120,
+				"accountEnabled eq false and userType eq 'Member'": 7,
+			},
+			WantErr: true,
+		},
+	}, func(tb testing.TB, logger *slog.Logger, server *fakegraph.Server, counts map[string]int) testutil.Scraper {
+		server.HandleFunc(http.MethodGet, "/v1.0/users/$count", func(query url.Values) fakegraph.Response {
+			count, ok := counts[query.Get("$filter")]
+			if !ok {
+				return fakegraph.ErrorResponse(http.StatusForbidden, "Authorization_RequestDenied", "Insufficient privileges to complete the operation.")
+			}
+
+			return fakegraph.Response{Header: http.Header{"Content-Type": []string{"text/plain"}}, Body: strconv.Itoa(count)}
+		})
+
+		return entraid.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(tb))
+	})
+}
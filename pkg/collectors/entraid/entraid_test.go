@@ -10,6 +10,7 @@ import (
 
 	"github.com/cloudeteer/m365-exporter/internal/testutil"
 	"github.com/cloudeteer/m365-exporter/pkg/auth"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	"github.com/cloudeteer/m365-exporter/pkg/httpclient"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
@@ -30,11 +31,11 @@ func TestCollector_scrapeUsers(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
 	// TODO: make this a singleton for all tests
-	msGraphClient, azureCredential, err := auth.NewMSGraphClient(http.DefaultClient)
+	msGraphClient, azureCredential, err := auth.NewMSGraphClient(http.DefaultClient, cloud.AzurePublic, auth.Settings{})
 	require.NoError(t, err)
 
-	httpClient := httpclient.New(prometheus.NewRegistry())
-	httpClient.WithAzureCredential(azureCredential)
+	httpClient := httpclient.New(prometheus.NewRegistry(), httpclient.Settings{})
+	httpClient.WithAzureCredential(azureCredential, cloud.AzurePublic)
 
 	collector := NewCollector(logger, tenantID, msGraphClient)
 
@@ -0,0 +1,327 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of CmdletMetric.Value.
+const (
+	CmdletValueCount = "count"
+	CmdletValueSum   = "sum"
+	CmdletValueField = "field"
+)
+
+var (
+	// cmdletPattern only allows read-only cmdlets.
+	cmdletPattern     = regexp.MustCompile(`^Get-[A-Za-z]+$`)
+	metricNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	labelNamePattern  = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+)
+
+var errCmdletNotAllowed = errors.New("only Get-* cmdlets are allowed")
+
+// builtinMetricNames are the names of the metrics of the collector itself, cmdlet metrics must not reuse them.
+var builtinMetricNames = []string{
+	"mailflow_messages",
+	"mailflow_daily_messages",
+	"mailflow_messages_total",
+	"mailbox_size_bytes",
+	"mailbox_quota_status_mailboxes",
+	"mailboxes_near_quota",
+	"archive_mailboxes",
+	"mailbox_storage_used_bytes",
+	"mailbox_prohibit_send_receive_quota_bytes",
+	"connector_enabled",
+	"connector_tls_required",
+	"accepted_domains",
+	"dkim_signing_enabled",
+	"dkim_signing_status",
+	"dkim_key_rotation_date_time",
+	"spf_record",
+	"dmarc_record",
+	"quarantine_messages",
+	"quarantine_truncated",
+	"zap_messages",
+	"message_trace_failed_messages",
+	"message_trace_truncated",
+	"section_success",
+}
+
+// builtinSectionNames are the sections of the collector itself, cmdlet metrics are sections named after the metric.
+var builtinSectionNames = []string{
+	sectionMailboxUsage,
+	sectionMailSecurity,
+	sectionQuarantine,
+	sectionZAP,
+	sectionMessageTrace,
+}
+
+// CmdletMetric maps the results of a cmdlet run via InvokeCommand to a metric.
+type CmdletMetric struct {
+	// Name of the metric below m365_exchange_, e.g. transport_rules.
+	Name string `mapstructure:"name"`
+	Help string `mapstructure:"help"`
+	// Cmdlet is the name of a Get-* cmdlet, e.g. Get-QuarantineMessage.
+	Cmdlet     string         `mapstructure:"cmdlet"`
+	Parameters map[string]any `mapstructure:"parameters"`
+	// Labels maps label names to fields of the results.
+	Labels map[string]string `mapstructure:"labels"`
+	// Value is CmdletValueCount, CmdletValueSum or CmdletValueField.
+	Value string `mapstructure:"value"`
+	// Field is summed up with CmdletValueSum or used as value with CmdletValueField. Nested fields are separated by dots.
+	Field string `mapstructure:"field"`
+}
+
+type cmdletRequest struct {
+	CmdletInput struct {
+		CmdletName string         `json:"CmdletName"`
+		Parameters map[string]any `json:"Parameters,omitempty"`
+	} `json:"CmdletInput"`
+}
+
+// cmdletCollector is a configured cmdlet with the desc of its metric.
+type cmdletCollector struct {
+	CmdletMetric
+
+	desc *prometheus.Desc
+	// labelNames are the sorted keys of Labels, in the order of the desc.
+	labelNames []string
+}
+
+// ValidateCmdlets validates every metric and checks that no two metrics have the same name.
+func ValidateCmdlets(metrics []CmdletMetric) error {
+	names := make(map[string]struct{}, len(metrics))
+
+	for _, metric := range metrics {
+		err := metric.Validate()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := names[metric.Name]; ok {
+			return fmt.Errorf("metric %s: name is used by another cmdlet metric", metric.Name)
+		}
+
+		names[metric.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// Validate checks the metric name, labels and value of m and that the cmdlet is read-only.
+func (m CmdletMetric) Validate() error {
+	if !metricNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("invalid metric name %q", m.Name)
+	}
+
+	if slices.Contains(builtinMetricNames, m.Name) {
+		return fmt.Errorf("metric %s: name is used by a metric of the exchange collector", m.Name)
+	}
+
+	if slices.Contains(builtinSectionNames, m.Name) {
+		return fmt.Errorf("metric %s: name is used by a section of the exchange collector", m.Name)
+	}
+
+	if !cmdletPattern.MatchString(m.Cmdlet) {
+		return fmt.Errorf("metric %s: %w, got %q", m.Name, errCmdletNotAllowed, m.Cmdlet)
+	}
+
+	for label, field := range m.Labels {
+		if !labelNamePattern.MatchString(label) || label == "tenant" {
+			return fmt.Errorf("metric %s: invalid label name %q", m.Name, label)
+		}
+
+		if field == "" {
+			return fmt.Errorf("metric %s: label %s has no field", m.Name, label)
+		}
+	}
+
+	switch m.Value {
+	case CmdletValueCount:
+	case CmdletValueSum, CmdletValueField:
+		if m.Field == "" {
+			return fmt.Errorf("metric %s: value %s needs a field", m.Name, m.Value)
+		}
+	default:
+		return fmt.Errorf("metric %s: invalid value %q, expected %s, %s or %s", m.Name, m.Value, CmdletValueCount, CmdletValueSum, CmdletValueField)
+	}
+
+	return nil
+}
+
+func newCmdletCollectors(tenant string, metrics []CmdletMetric) []cmdletCollector {
+	collectors := make([]cmdletCollector, 0, len(metrics))
+
+	for _, metric := range metrics {
+		labelNames := make([]string, 0, len(metric.Labels))
+		for label := range metric.Labels {
+			labelNames = append(labelNames, label)
+		}
+
+		slices.Sort(labelNames)
+
+		help := metric.Help
+		if help == "" {
+			help = "result of " + metric.Cmdlet
+		}
+
+		collectors = append(collectors, cmdletCollector{
+			CmdletMetric: metric,
+			labelNames:   labelNames,
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(abstract.Namespace, subsystem, metric.Name),
+				help,
+				labelNames,
+				prometheus.Labels{
+					"tenant": tenant,
+				},
+			),
+		})
+	}
+
+	return collectors
+}
+
+// scrapeCmdlet runs the cmdlet of cmdlet and aggregates its results by the configured labels.
+func (c *Collector) scrapeCmdlet(ctx context.Context, cmdlet cmdletCollector) ([]prometheus.Metric, error) {
+	// settings are validated on startup, but the cmdlet is checked again right before it is sent
+	if !cmdletPattern.MatchString(cmdlet.Cmdlet) {
+		return nil, fmt.Errorf("%w, got %q", errCmdletNotAllowed, cmdlet.Cmdlet)
+	}
+
+	results, err := invokeCmdlet[map[string]any](ctx, c, cmdlet.Cmdlet, cmdlet.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	type series struct {
+		labelValues []string
+		value       float64
+	}
+
+	aggregated := make(map[string]*series)
+	order := make([]string, 0)
+
+	for i, result := range results {
+		labelValues := make([]string, len(cmdlet.labelNames))
+		for j, label := range cmdlet.labelNames {
+			labelValues[j] = formatLabel(lookupField(result, cmdlet.Labels[label]))
+		}
+
+		value := 1.0
+
+		if cmdlet.Value != CmdletValueCount {
+			value, err = parseValue(lookupField(result, cmdlet.Field))
+			if err != nil {
+				return nil, fmt.Errorf("result %d of %s: field %s: %w", i, cmdlet.Cmdlet, cmdlet.Field, err)
+			}
+		}
+
+		key := strings.Join(labelValues, "\xff")
+
+		s, ok := aggregated[key]
+		if !ok {
+			s = &series{labelValues: labelValues}
+			aggregated[key] = s
+			order = append(order, key)
+		}
+
+		// with CmdletValueField, the last result of the same labels wins
+		if cmdlet.Value == CmdletValueField {
+			s.value = value
+		} else {
+			s.value += value
+		}
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(aggregated))
+
+	// without labels, a count or sum of 0 is reported as well
+	if len(cmdlet.labelNames) == 0 && len(aggregated) == 0 && cmdlet.Value != CmdletValueField {
+		return append(metrics, prometheus.MustNewConstMetric(cmdlet.desc, prometheus.GaugeValue, 0)), nil
+	}
+
+	for _, key := range order {
+		s := aggregated[key]
+		metrics = append(metrics, prometheus.MustNewConstMetric(cmdlet.desc, prometheus.GaugeValue, s.value, s.labelValues...))
+	}
+
+	return metrics, nil
+}
+
+// invokeCmdlet runs cmdlet via InvokeCommand and returns the results of all pages.
+func invokeCmdlet[T any](ctx context.Context, c *Collector, cmdlet string, parameters map[string]any) ([]T, error) {
+	var request cmdletRequest
+	request.CmdletInput.CmdletName = cmdlet
+	request.CmdletInput.Parameters = parameters
+
+	results, err := rest.PostAll[T](ctx, c.restClient, c.httpExchangeAdminBaseURL, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", cmdlet, err)
+	}
+
+	return results, nil
+}
+
+// lookupField returns the value of a field of result, nested fields are separated by dots.
+func lookupField(result map[string]any, field string) any {
+	var value any = result
+
+	for _, name := range strings.Split(field, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		value = object[name]
+	}
+
+	return value
+}
+
+func formatLabel(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func parseValue(value any) (float64, error) {
+	switch value := value.(type) {
+	case float64:
+		return value, nil
+	case bool:
+		if value {
+			return 1, nil
+		}
+
+		return 0, nil
+	case string:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q: %w", value, err)
+		}
+
+		return number, nil
+	default:
+		return 0, fmt.Errorf("unsupported value %v", value)
+	}
+}
@@ -0,0 +1,188 @@
+package exchange_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/exchange"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCmdletMetric_Validate(t *testing.T) {
+	t.Parallel()
+
+	valid := exchange.CmdletMetric{
+		Name:   "quarantined_messages",
+		Cmdlet: "Get-QuarantineMessage",
+		Labels: map[string]string{"type": "QuarantineTypes"},
+		Value:  exchange.CmdletValueCount,
+	}
+
+	require.NoError(t, valid.Validate())
+
+	for name, modify := range map[string]func(m *exchange.CmdletMetric){
+		"set cmdlet":        func(m *exchange.CmdletMetric) { m.Cmdlet = "Set-Mailbox" },
+		"injected cmdlet":   func(m *exchange.CmdletMetric) { m.Cmdlet = "Get-Mailbox; Remove-Mailbox" },
+		"metric name":       func(m *exchange.CmdletMetric) { m.Name = "quarantine-messages" },
+		"tenant label":      func(m *exchange.CmdletMetric) { m.Labels = map[string]string{"tenant": "Organization"} },
+		"empty label":       func(m *exchange.CmdletMetric) { m.Labels = map[string]string{"type": ""} },
+		"unknown value":     func(m *exchange.CmdletMetric) { m.Value = "avg" },
+		"sum without field": func(m *exchange.CmdletMetric) { m.Value = exchange.CmdletValueSum },
+		"built-in name":     func(m *exchange.CmdletMetric) { m.Name = "quarantine_messages" },
+		"built-in section":  func(m *exchange.CmdletMetric) { m.Name = "quarantine" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			metric := valid
+			modify(&metric)
+			assert.Error(t, metric.Validate())
+		})
+	}
+}
+
+func TestValidateCmdlets(t *testing.T) {
+	t.Parallel()
+
+	metric := exchange.CmdletMetric{Name: "transport_rules", Cmdlet: "Get-TransportRule", Value: exchange.CmdletValueCount}
+
+	require.NoError(t, exchange.ValidateCmdlets([]exchange.CmdletMetric{metric}))
+	require.ErrorContains(t, exchange.ValidateCmdlets([]exchange.CmdletMetric{metric, metric}), "transport_rules")
+
+	// TODO: Go 1.24: Change to slog.NewDiscardHandler
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	collector := exchange.NewCollector(logger, "contoso.onmicrosoft.com", nil, nil, cloud.Environment{}, exchange.Settings{})
+
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		collector.Describe(descs)
+		close(descs)
+	}()
+
+	fqNamePattern := regexp.MustCompile(`fqName: "m365_exchange_([a-z0-9_]+)"`)
+
+	for desc := range descs {
+		match := fqNamePattern.FindStringSubmatch(desc.String())
+		if match == nil {
+			continue
+		}
+
+		metric.Name = match[1]
+		assert.Error(t, exchange.ValidateCmdlets([]exchange.CmdletMetric{metric}), "built-in metric %s", metric.Name)
+	}
+}
+
+func TestCollector_ScrapeMetrics_Cmdlets(t *testing.T) {
+	t.Parallel()
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			CmdletInput struct {
+				CmdletName string         `json:"CmdletName"`
+				Parameters map[string]any `json:"Parameters"`
+			} `json:"CmdletInput"`
+		}
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		switch request.CmdletInput.CmdletName {
+		case "Get-MailFlowStatusReport":
+			_, _ = io.WriteString(w, `{"value":[]}`)
+		case "Get-QuarantineMessage":
+			assert.InDelta(t, 1000, request.CmdletInput.Parameters["PageSize"], 0)
+
+			if r.URL.Query().Get("$skiptoken") == "" {
+				_, _ = io.WriteString(w, `{"value":[
+					{"QuarantineTypes":"Spam","ReleaseStatus":"NotReleased","Size":100},
+					{"QuarantineTypes":"Phish","ReleaseStatus":"NotReleased","Size":300}
+				],"@odata.nextLink":"`+server.URL+r.URL.Path+`?$skiptoken=1"}`)
+
+				return
+			}
+
+			_, _ = io.WriteString(w, `{"value":[{"QuarantineTypes":"Spam","ReleaseStatus":"Released","Size":50},{"QuarantineTypes":"Spam","ReleaseStatus":"NotReleased","Size":20}]}`)
+		case "Get-AcceptedDomain":
+			_, _ = io.WriteString(w, `{"value":[]}`)
+		case "Get-TransportConfig":
+			_, _ = io.WriteString(w, `{"value":[{"Identity":"Transport","MaxSendSize":{"Value":"35 MB","Bytes":36700160}}]}`)
+		case "Get-DkimSigningConfig":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"error":{"code":"Forbidden","message":"The caller doesn't have the role to run Get-DkimSigningConfig."}}`)
+		default:
+			t.Errorf("unexpected cmdlet %s", request.CmdletInput.CmdletName)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	// TODO: Go 1.24: Change to slog.NewDiscardHandler
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	collector := exchange.NewCollector(logger, "contoso.onmicrosoft.com", nil, server.Client(), cloud.Environment{ExchangeEndpoint: server.URL}, exchange.Settings{
+		Cmdlets: []exchange.CmdletMetric{
+			{
+				Name:       "quarantined_messages",
+				Help:       "number of quarantined messages",
+				Cmdlet:     "Get-QuarantineMessage",
+				Parameters: map[string]any{"PageSize": 1000},
+				Labels:     map[string]string{"type": "QuarantineTypes", "release_status": "ReleaseStatus"},
+				Value:      exchange.CmdletValueCount,
+			},
+			{
+				Name:       "quarantined_messages_bytes",
+				Cmdlet:     "Get-QuarantineMessage",
+				Parameters: map[string]any{"PageSize": 1000},
+				Value:      exchange.CmdletValueSum,
+				Field:      "Size",
+			},
+			{
+				Name:   "accepted_domain_count",
+				Cmdlet: "Get-AcceptedDomain",
+				Value:  exchange.CmdletValueCount,
+			},
+			{
+				Name:   "max_send_size_bytes",
+				Cmdlet: "Get-TransportConfig",
+				Labels: map[string]string{"identity": "Identity"},
+				Value:  exchange.CmdletValueField,
+				Field:  "MaxSendSize.Bytes",
+			},
+			{
+				Name:   "dkim_signing_configs",
+				Cmdlet: "Get-DkimSigningConfig",
+				Value:  exchange.CmdletValueCount,
+			},
+		},
+	})
+
+	// TODO: Go 1.24: Change to t.Context()
+	metrics, err := collector.ScrapeMetrics(context.Background())
+	require.NoError(t, err)
+
+	text, err := testutil.MetricsToText(t, metrics)
+	require.NoError(t, err)
+
+	assert.Contains(t, text, `m365_exchange_quarantined_messages{release_status="NotReleased",tenant="contoso.onmicrosoft.com",type="Spam"} 2`)
+	assert.Contains(t, text, `m365_exchange_quarantined_messages{release_status="NotReleased",tenant="contoso.onmicrosoft.com",type="Phish"} 1`)
+	assert.Contains(t, text, `m365_exchange_quarantined_messages{release_status="Released",tenant="contoso.onmicrosoft.com",type="Spam"} 1`)
+	assert.Contains(t, text, `m365_exchange_quarantined_messages_bytes{tenant="contoso.onmicrosoft.com"} 470`)
+	assert.Contains(t, text, `m365_exchange_accepted_domain_count{tenant="contoso.onmicrosoft.com"} 0`)
+	assert.Contains(t, text, `m365_exchange_max_send_size_bytes{identity="Transport",tenant="contoso.onmicrosoft.com"} 3.670016e+07`)
+
+	// a failing cmdlet is reported as its own section and doesn't discard the other metrics
+	assert.Contains(t, text, `m365_exchange_section_success{section="dkim_signing_configs",tenant="contoso.onmicrosoft.com"} 0`)
+	assert.Contains(t, text, `m365_exchange_section_success{section="max_send_size_bytes",tenant="contoso.onmicrosoft.com"} 1`)
+	assert.NotContains(t, text, "m365_exchange_dkim_signing_configs{")
+}
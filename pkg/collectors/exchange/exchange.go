@@ -3,41 +3,122 @@ package exchange
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
+	"github.com/cloudeteer/m365-exporter/pkg/util"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const subsystem = "exchange"
 
 const (
-	exchangeOnlineAdminAPI = "https://outlook.office365.com/adminapi/beta/%s/InvokeCommand"
+	exchangeOnlineAdminAPI = "%s/adminapi/beta/%s/InvokeCommand"
 )
 
 // Interface guard.
 var _ abstract.Collector = (*Collector)(nil)
 
+// Names of the optional sections in m365_exchange_section_success.
+const (
+	sectionMailboxUsage = "mailbox_usage"
+	sectionMailSecurity = "mail_security"
+	sectionQuarantine   = "quarantine"
+	sectionZAP          = "zap"
+	sectionMessageTrace = "message_trace"
+)
+
+// section is an optional part of the scrape, its errors are reported by m365_exchange_section_success.
+type section struct {
+	name    string
+	enabled bool
+	scrape  func(ctx context.Context) ([]prometheus.Metric, error)
+}
+
 type Collector struct {
 	abstract.BaseCollector
 
 	logger *slog.Logger
 
 	mailflowMessageCount *prometheus.Desc
+	mailflowDailyDesc    *prometheus.Desc
+	mailflowTotalDesc    *prometheus.Desc
+
+	mailboxSizeDesc      *prometheus.Desc
+	quotaStatusDesc      *prometheus.Desc
+	nearQuotaDesc        *prometheus.Desc
+	archiveMailboxesDesc *prometheus.Desc
+	mailboxUsedDesc      *prometheus.Desc
+	mailboxQuotaDesc     *prometheus.Desc
+
+	connectorEnabledDesc *prometheus.Desc
+	connectorTLSDesc     *prometheus.Desc
+	acceptedDomainsDesc  *prometheus.Desc
+	dkimEnabledDesc      *prometheus.Desc
+	dkimStatusDesc       *prometheus.Desc
+	dkimRotationDesc     *prometheus.Desc
+	spfRecordDesc        *prometheus.Desc
+	dmarcRecordDesc      *prometheus.Desc
+
+	quarantineDesc            *prometheus.Desc
+	quarantineTruncatedDesc   *prometheus.Desc
+	zapMessagesDesc           *prometheus.Desc
+	messageTraceFailedDesc    *prometheus.Desc
+	messageTraceTruncatedDesc *prometheus.Desc
+	sectionSuccessDesc        *prometheus.Desc
+
+	cmdlets []cmdletCollector
+
+	mailflowCounters *mailflowCounters
 
 	httpExchangeAdminBaseURL string
-	httpClient               *http.Client
+	restClient               *rest.Client
+
+	settings Settings
 }
 
-func NewCollector(logger *slog.Logger, tenant string, httpClient *http.Client) *Collector {
+type Settings struct {
+	// MailflowDaily adds the count of every complete day of the mail flow report, labeled with the day and with the
+	// day as timestamp. Later corrections of a day are rejected by Prometheus, they only show up in MailflowCounter.
+	MailflowDaily bool
+	// MailflowCounter adds counters of the mail flow which sum up all days.
+	MailflowCounter bool
+	// MailflowStateFile keeps the mail flow counters across restarts, they are kept in memory only if empty.
+	MailflowStateFile string
+	// MailboxUsage enables the mailbox size and quota metrics of the Graph usage reports. Like MailSecurity,
+	// Quarantine, ZAP and MessageTrace, its errors are reported by m365_exchange_section_success.
+	MailboxUsage bool
+	// MailboxDetails adds the usage and quota of every mailbox, see ScrambleNames.
+	MailboxDetails bool
+	ScrambleNames  bool
+	ScrambleSalt   string
+	// MailSecurity enables the connector, accepted domain, DKIM, SPF and DMARC metrics.
+	MailSecurity bool
+	// Resolver looks up the SPF and DMARC records, the resolver of the system if nil.
+	Resolver Resolver
+	// Quarantine, ZAP and MessageTrace enable sections which need further Exchange roles, their errors are reported by
+	// m365_exchange_section_success instead of failing the scrape.
+	Quarantine   bool
+	ZAP          bool
+	MessageTrace bool
+	// Cmdlets are run in addition to Get-MailFlowStatusReport, they are expected to be validated. Each cmdlet is a
+	// section named after its metric.
+	Cmdlets []CmdletMetric
+}
+
+func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, httpClient *http.Client, env cloud.Environment, settings Settings) *Collector {
+	if settings.Resolver == nil {
+		settings.Resolver = NewResolver("")
+	}
+
 	return &Collector{
-		BaseCollector: abstract.NewBaseCollector(nil, subsystem),
+		BaseCollector: abstract.NewBaseCollector(msGraphClient, subsystem),
 		logger:        logger.With(slog.String("collector", subsystem)),
 		mailflowMessageCount: prometheus.NewDesc(
 			prometheus.BuildFQName(abstract.Namespace, subsystem, "mailflow_messages"),
@@ -51,8 +132,187 @@ func NewCollector(logger *slog.Logger, tenant string, httpClient *http.Client) *
 				"tenant": tenant,
 			},
 		),
-		httpExchangeAdminBaseURL: fmt.Sprintf(exchangeOnlineAdminAPI, tenant),
-		httpClient:               httpClient,
+		mailflowDailyDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "mailflow_daily_messages"),
+			"number of messages in the mail flow of a complete day, with the day as timestamp",
+			[]string{"organization", "direction", "event_type", "day"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		mailflowTotalDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "mailflow_messages_total"),
+			"number of messages in the mail flow, summed up over all complete days",
+			[]string{"organization", "direction", "event_type"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		mailboxSizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "mailbox_size_bytes"),
+			"storage used by mailboxes, excluding the archive",
+			nil,
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		quotaStatusDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "mailbox_quota_status_mailboxes"),
+			"number of mailboxes by quota status, e.g. warning_issued or send_prohibited",
+			[]string{"status"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		nearQuotaDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "mailboxes_near_quota"),
+			"number of mailboxes using at least 90% of a quota",
+			[]string{"quota"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		archiveMailboxesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "archive_mailboxes"),
+			"number of mailboxes with an archive",
+			nil,
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		mailboxUsedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "mailbox_storage_used_bytes"),
+			"storage used by a mailbox",
+			[]string{"mailbox", "recipient_type"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		mailboxQuotaDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "mailbox_prohibit_send_receive_quota_bytes"),
+			"size from which a mailbox can neither send nor receive",
+			[]string{"mailbox", "recipient_type"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		connectorEnabledDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "connector_enabled"),
+			"status of a mail connector",
+			[]string{"direction", "connector"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		connectorTLSDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "connector_tls_required"),
+			"whether a mail connector requires TLS",
+			[]string{"direction", "connector"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		acceptedDomainsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "accepted_domains"),
+			"number of accepted domains by type, e.g. Authoritative or InternalRelay",
+			[]string{"type"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		dkimEnabledDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "dkim_signing_enabled"),
+			"status of DKIM signing of a domain",
+			[]string{"domain"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		dkimStatusDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "dkim_signing_status"),
+			"status of the DKIM selectors of a domain, e.g. Valid or CnameMissing",
+			[]string{"domain", "status"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		dkimRotationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "dkim_key_rotation_date_time"),
+			"last Unix time the DKIM keys of a domain were rotated",
+			[]string{"domain"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		spfRecordDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "spf_record"),
+			"whether an accepted domain has an SPF record in DNS",
+			[]string{"domain"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		dmarcRecordDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "dmarc_record"),
+			"whether an accepted domain has a DMARC record in DNS",
+			[]string{"domain"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		quarantineDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "quarantine_messages"),
+			"number of quarantined messages by type and release status",
+			[]string{"type", "release_status"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		quarantineTruncatedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "quarantine_truncated"),
+			"whether the quarantined messages exceeded the pages read per scrape",
+			nil,
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		zapMessagesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "zap_messages"),
+			"number of delivered messages removed by zero-hour auto purge on the most recent complete day",
+			[]string{"type"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		messageTraceFailedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "message_trace_failed_messages"),
+			"number of messages with message trace status Failed in the last 24 hours",
+			nil,
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		messageTraceTruncatedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "message_trace_truncated"),
+			"whether the failed messages reached the result size limit of the message trace",
+			nil,
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		sectionSuccessDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "section_success"),
+			"whether an optional section of the collector was scraped successfully",
+			[]string{"section"},
+			prometheus.Labels{
+				"tenant": tenant,
+			},
+		),
+		httpExchangeAdminBaseURL: fmt.Sprintf(exchangeOnlineAdminAPI, env.ExchangeEndpoint, tenant),
+		restClient:               rest.NewClient(httpClient, rest.Settings{Service: util.ServiceExchange}),
+		cmdlets:                  newCmdletCollectors(tenant, settings.Cmdlets),
+		mailflowCounters:         newMailflowCounters(settings.MailflowStateFile),
+		settings:                 settings,
 	}
 }
 
@@ -60,110 +320,182 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	permissions := []abstract.Permission{
+		{Resource: abstract.ResourceExchange, Name: "Exchange.ManageAsApp"},
+	}
+
+	if c.settings.MailboxUsage {
+		permissions = append(permissions, abstract.OptionalGraphPermissions("Reports.Read.All")...)
+	}
+
+	return permissions
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
 	ch <- c.mailflowMessageCount
-}
 
-func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, error) {
-	// set a timeout for the request
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+	ch <- c.mailflowDailyDesc
 
-	metrics := make([]prometheus.Metric, 0)
-	errs := make([]error, 0)
+	ch <- c.mailflowTotalDesc
 
-	mailflowMetrics, err := c.scrapeMailflowMetrics(ctx)
-	if err != nil {
-		errs = append(errs, fmt.Errorf("error scraping mailflow metrics: %w", err))
-	}
+	ch <- c.mailboxSizeDesc
 
-	metrics = append(metrics, mailflowMetrics...)
+	ch <- c.quotaStatusDesc
 
-	return metrics, errors.Join(errs...)
-}
+	ch <- c.nearQuotaDesc
 
-//nolint:cyclop
-func (c *Collector) scrapeMailflowMetrics(ctx context.Context) ([]prometheus.Metric, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.httpExchangeAdminBaseURL,
-		strings.NewReader(`{"CmdletInput": {"CmdletName": "Get-MailFlowStatusReport"}}`),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	ch <- c.archiveMailboxesDesc
+
+	ch <- c.mailboxUsedDesc
+
+	ch <- c.mailboxQuotaDesc
+
+	ch <- c.connectorEnabledDesc
+
+	ch <- c.connectorTLSDesc
+
+	ch <- c.acceptedDomainsDesc
+
+	ch <- c.dkimEnabledDesc
+
+	ch <- c.dkimStatusDesc
+
+	ch <- c.dkimRotationDesc
+
+	ch <- c.spfRecordDesc
+
+	ch <- c.dmarcRecordDesc
+
+	ch <- c.quarantineDesc
+
+	ch <- c.quarantineTruncatedDesc
+
+	ch <- c.zapMessagesDesc
+
+	ch <- c.messageTraceFailedDesc
+
+	ch <- c.messageTraceTruncatedDesc
+
+	ch <- c.sectionSuccessDesc
+
+	for _, cmdlet := range c.cmdlets {
+		ch <- cmdlet.desc
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
+func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, error) {
+	// set a timeout for the request
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
-	resp, err := c.httpClient.Do(req)
+	// Get-MailFlowStatusReport is the only section which fails the scrape
+	metrics, err := c.scrapeMailflowMetrics(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, fmt.Errorf("error scraping mailflow metrics: %w", err)
 	}
 
-	defer func() {
-		err := resp.Body.Close()
+	for _, section := range c.sections() {
+		if !section.enabled {
+			continue
+		}
+
+		// the sections need further roles or permissions, a missing one shouldn't discard the other metrics
+		sectionMetrics, err := section.scrape(ctx)
 		if err != nil {
-			c.logger.ErrorContext(ctx, "error closing response body", slog.Any("err", err))
+			c.logger.WarnContext(ctx, "failed to scrape section", slog.String("section", section.name), slog.Any("err", err))
 		}
-	}()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		metrics = append(metrics, sectionMetrics...)
+		metrics = append(metrics, prometheus.MustNewConstMetric(c.sectionSuccessDesc, prometheus.GaugeValue, boolToFloat64(err == nil), section.name))
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error unmarshalling response (status %d): %s", resp.StatusCode, body)
+	return metrics, nil
+}
+
+// sections returns the optional sections of the collector followed by the configured cmdlets, which are named after
+// their metric.
+func (c *Collector) sections() []section {
+	sections := []section{
+		{name: sectionMailboxUsage, enabled: c.settings.MailboxUsage, scrape: c.scrapeMailboxUsage},
+		{name: sectionMailSecurity, enabled: c.settings.MailSecurity, scrape: c.scrapeMailSecurity},
+		{name: sectionQuarantine, enabled: c.settings.Quarantine, scrape: c.scrapeQuarantine},
+		{name: sectionZAP, enabled: c.settings.ZAP, scrape: c.scrapeZAP},
+		{name: sectionMessageTrace, enabled: c.settings.MessageTrace, scrape: c.scrapeMessageTrace},
 	}
 
-	var mailFlowResponse MailFlowResponse
+	for _, cmdlet := range c.cmdlets {
+		sections = append(sections, section{name: cmdlet.Name, enabled: true, scrape: func(ctx context.Context) ([]prometheus.Metric, error) {
+			return c.scrapeCmdlet(ctx, cmdlet)
+		}})
+	}
+
+	return sections
+}
 
-	err = json.Unmarshal(body, &mailFlowResponse)
+func (c *Collector) scrapeMailflowMetrics(ctx context.Context) ([]prometheus.Metric, error) {
+	mailFlowResponse, err := rest.PostJSON[MailFlowResponse](ctx, c.restClient, c.httpExchangeAdminBaseURL,
+		json.RawMessage(`{"CmdletInput": {"CmdletName": "Get-MailFlowStatusReport"}}`),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling response: body %s, error %w", body, err)
+		return nil, fmt.Errorf("failed to get mail flow status: %w", err)
 	}
 
 	// Find the most recent date in the response
 	var lastDateValue time.Time
 
+	rows := make([]mailflowRow, 0, len(mailFlowResponse.Value))
+
 	for _, mailFlow := range mailFlowResponse.Value {
-		date, err := time.Parse("2006-01-02T15:04:05.0000000", mailFlow.Date)
+		date, err := time.Parse(mailflowDateLayout, mailFlow.Date)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing date: %w", err)
 		}
 
-		// Skip if the date is not after the last date
-		// Also, skip "today", because the data is incomplete.
-		if !date.After(lastDateValue) || date.After(time.Now().Add(-24*time.Hour)) {
+		// Skip "today", because the data is incomplete.
+		if date.After(time.Now().Add(-24 * time.Hour)) {
 			continue
 		}
 
-		// Update the last date
-		lastDateValue = date
+		rows = append(rows, mailflowRow{MailFlowResponseRow: mailFlow, date: date})
+
+		if date.After(lastDateValue) {
+			lastDateValue = date
+		}
 	}
 
 	metrics := make([]prometheus.Metric, 0)
 
 	// Find the most recent mail flow status
-	for _, mailFlow := range mailFlowResponse.Value {
-		date, err := time.Parse("2006-01-02T15:04:05.0000000", mailFlow.Date)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing date: %w", err)
-		}
-
-		if !date.Equal(lastDateValue) {
+	for _, row := range rows {
+		if !row.date.Equal(lastDateValue) {
 			continue
 		}
 
 		metrics = append(metrics, prometheus.MustNewConstMetric(
 			c.mailflowMessageCount,
 			prometheus.GaugeValue,
-			float64(mailFlow.MessageCount),
-			mailFlow.Organization,
-			mailFlow.Direction,
-			mailFlow.EventType,
+			float64(row.MessageCount),
+			row.Organization,
+			row.Direction,
+			row.EventType,
 		))
 	}
 
+	if c.settings.MailflowDaily {
+		metrics = append(metrics, c.mailflowDailyMetrics(rows)...)
+	}
+
+	if c.settings.MailflowCounter {
+		counterMetrics, err := c.mailflowCounterMetrics(rows)
+		if err != nil {
+			c.logger.WarnContext(ctx, "failed to use mail flow state file", slog.Any("err", err))
+		}
+
+		metrics = append(metrics, counterMetrics...)
+	}
+
 	return metrics, nil
 }
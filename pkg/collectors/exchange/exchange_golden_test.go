@@ -0,0 +1,57 @@
+package exchange_test
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/exchange"
+)
+
+// stubResolver answers TXT lookups from a map, unknown names don't exist and the record "servfail" fails the lookup.
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	if len(records) == 1 && records[0] == "servfail" {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+	}
+
+	return records, nil
+}
+
+func TestCollector_ScrapeMetrics_Golden(t *testing.T) {
+	t.Parallel()
+
+	testutil.RunGolden(t, []testutil.GoldenCase[exchange.Settings]{
+		{Name: "default"},
+		{Name: "no_data"},
+		{Name: "invalid_date", WantErr: true},
+		{Name: "unauthorized", WantErr: true},
+		{Name: "mailflow_history", Settings: exchange.Settings{MailflowDaily: true, MailflowCounter: true}},
+		{Name: "mailbox_usage", Settings: exchange.Settings{MailboxUsage: true}},
+		{Name: "mailbox_details", Settings: exchange.Settings{MailboxUsage: true, MailboxDetails: true, ScrambleNames: true, ScrambleSalt: "salt"}},
+		{Name: "mailbox_usage_forbidden", Settings: exchange.Settings{MailboxUsage: true}},
+		{Name: "mailbox_usage_failed", Settings: exchange.Settings{MailboxUsage: true}},
+		{Name: "threat_protection", Settings: exchange.Settings{Quarantine: true, ZAP: true, MessageTrace: true}},
+		{Name: "threat_protection_forbidden", Settings: exchange.Settings{Quarantine: true, ZAP: true, MessageTrace: true}},
+		{Name: "mail_security", Settings: exchange.Settings{MailSecurity: true, Resolver: stubResolver{
+			"contoso.com":                         {"google-site-verification=abc", "v=spf1 include:spf.protection.outlook.com -all"},
+			"_dmarc.contoso.com":                  {"v=DMARC1; p=reject"},
+			"fabrikam.com":                        {"v=spf1 -all"},
+			"contoso.onmicrosoft.com":             {"v=spf1 include:spf.protection.outlook.com -all"},
+			"_dmarc.contoso.onmicrosoft.com":      nil,
+			"_dmarc.contoso.mail.onmicrosoft.com": {"servfail"},
+		}}},
+		{Name: "mail_security_forbidden", Settings: exchange.Settings{MailSecurity: true, Resolver: stubResolver{}}},
+	}, func(tb testing.TB, logger *slog.Logger, server *fakegraph.Server, settings exchange.Settings) testutil.Scraper {
+		return exchange.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(tb), server.Client(), server.Environment(), settings)
+	})
+}
@@ -0,0 +1,260 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/cloudeteer/m365-exporter/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reportPeriod is the shortest period of the usage reports, the detail report contains the latest value anyway.
+const reportPeriod = "D7"
+
+// nearQuotaRatio is the share of a quota from which a mailbox counts as near it.
+const nearQuotaRatio = 0.9
+
+const gib = 1 << 30
+
+// mailboxSizeBuckets are the upper bounds of the mailbox size histogram, the default quotas are 50 and 100 GiB.
+var mailboxSizeBuckets = []float64{1 * gib, 2 * gib, 5 * gib, 10 * gib, 20 * gib, 40 * gib, 50 * gib, 75 * gib, 100 * gib}
+
+// quotaStatusColumns maps the columns of the quota status report to the status label.
+var quotaStatusColumns = map[string]string{
+	"Under Limit":             "under_limit",
+	"Warning Issued":          "warning_issued",
+	"Send Prohibited":         "send_prohibited",
+	"Send/Receive Prohibited": "send_receive_prohibited",
+	"Indeterminate":           "indeterminate",
+}
+
+// quotaColumns maps the quota columns of the detail report to the quota label.
+var quotaColumns = []struct {
+	column string
+	quota  string
+}{
+	{column: "Issue Warning Quota (Byte)", quota: "issue_warning"},
+	{column: "Prohibit Send Quota (Byte)", quota: "prohibit_send"},
+	{column: "Prohibit Send/Receive Quota (Byte)", quota: "prohibit_send_receive"},
+}
+
+// scrapeMailboxUsage returns the mailbox size, quota and archive metrics of the Graph usage reports.
+func (c *Collector) scrapeMailboxUsage(ctx context.Context) ([]prometheus.Metric, error) {
+	period := reportPeriod
+
+	statusReport, err := c.GraphClient().Reports().GetMailboxUsageQuotaStatusMailboxCountsWithPeriod(&period).Get(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mailbox quota status report: %w", util.GetOdataError(err))
+	}
+
+	detailReport, err := c.GraphClient().Reports().GetMailboxUsageDetailWithPeriod(&period).Get(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mailbox usage detail report: %w", util.GetOdataError(err))
+	}
+
+	statusRows, err := readCSVReport(statusReport)
+	if err != nil {
+		return nil, fmt.Errorf("error reading mailbox quota status report: %w", err)
+	}
+
+	detailRows, err := readCSVReport(detailReport)
+	if err != nil {
+		return nil, fmt.Errorf("error reading mailbox usage detail report: %w", err)
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(quotaStatusColumns)+len(quotaColumns)+2)
+	metrics = append(metrics, c.quotaStatusMetrics(ctx, statusRows)...)
+
+	return append(metrics, c.mailboxDetailMetrics(ctx, detailRows)...), nil
+}
+
+// quotaStatusMetrics returns the counts of the latest day of the quota status report.
+func (c *Collector) quotaStatusMetrics(ctx context.Context, rows []map[string]string) []prometheus.Metric {
+	var latest map[string]string
+
+	// the ISO dates sort lexically
+	for _, row := range rows {
+		if latest == nil || row["Report Date"] > latest["Report Date"] {
+			latest = row
+		}
+	}
+
+	if latest == nil {
+		return nil
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(quotaStatusColumns))
+
+	for column, status := range quotaStatusColumns {
+		count, err := parseNumber(latest[column])
+		if err != nil {
+			c.logger.WarnContext(ctx, "skipping invalid mailbox quota status", slog.String("status", status), slog.Any("err", err))
+
+			continue
+		}
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(c.quotaStatusDesc, prometheus.GaugeValue, count, status))
+	}
+
+	return metrics
+}
+
+// mailboxDetailMetrics returns the size histogram, the archive count and the mailboxes near a quota. Rows with an
+// invalid number are logged and skipped, they shouldn't hide the other mailboxes.
+//
+//nolint:cyclop
+func (c *Collector) mailboxDetailMetrics(ctx context.Context, rows []map[string]string) []prometheus.Metric {
+	buckets := make(map[float64]uint64, len(mailboxSizeBuckets))
+	for _, bucket := range mailboxSizeBuckets {
+		buckets[bucket] = 0
+	}
+
+	nearQuota := make(map[string]int, len(quotaColumns))
+	for _, quota := range quotaColumns {
+		nearQuota[quota.quota] = 0
+	}
+
+	var (
+		count    uint64
+		sum      float64
+		archives int
+		metrics  []prometheus.Metric
+	)
+
+	for _, row := range rows {
+		if strings.EqualFold(row["Is Deleted"], "true") {
+			continue
+		}
+
+		used, limits, err := parseMailboxRow(row)
+		if err != nil {
+			c.logger.WarnContext(ctx, "skipping invalid mailbox usage row", slog.Any("err", err))
+
+			continue
+		}
+
+		count++
+		sum += used
+
+		for _, bucket := range mailboxSizeBuckets {
+			if used <= bucket {
+				buckets[bucket]++
+			}
+		}
+
+		for i, quota := range quotaColumns {
+			if limits[i] > 0 && used >= nearQuotaRatio*limits[i] {
+				nearQuota[quota.quota]++
+			}
+		}
+
+		if strings.EqualFold(row["Has Archive"], "true") {
+			archives++
+		}
+
+		if c.settings.MailboxDetails {
+			mailbox := c.mailboxName(row["User Principal Name"])
+
+			// the send/receive quota is the last of quotaColumns
+			metrics = append(metrics,
+				prometheus.MustNewConstMetric(c.mailboxUsedDesc, prometheus.GaugeValue, used, mailbox, row["Recipient Type"]),
+				prometheus.MustNewConstMetric(c.mailboxQuotaDesc, prometheus.GaugeValue, limits[len(limits)-1], mailbox, row["Recipient Type"]),
+			)
+		}
+	}
+
+	metrics = append(metrics,
+		prometheus.MustNewConstHistogram(c.mailboxSizeDesc, count, sum, buckets),
+		prometheus.MustNewConstMetric(c.archiveMailboxesDesc, prometheus.GaugeValue, float64(archives)),
+	)
+
+	for quota, count := range nearQuota {
+		metrics = append(metrics, prometheus.MustNewConstMetric(c.nearQuotaDesc, prometheus.GaugeValue, float64(count), quota))
+	}
+
+	return metrics
+}
+
+// parseMailboxRow returns the used storage and the quotas of a row of the detail report, in the order of quotaColumns.
+func parseMailboxRow(row map[string]string) (float64, []float64, error) {
+	used, err := parseNumber(row["Storage Used (Byte)"])
+	if err != nil {
+		return 0, nil, fmt.Errorf("error parsing storage of mailbox: %w", err)
+	}
+
+	limits := make([]float64, len(quotaColumns))
+
+	for i, quota := range quotaColumns {
+		limits[i], err = parseNumber(row[quota.column])
+		if err != nil {
+			return 0, nil, fmt.Errorf("error parsing %s of mailbox: %w", quota.column, err)
+		}
+	}
+
+	return used, limits, nil
+}
+
+// mailboxName returns the UPN, or its salted hash if names are scrambled.
+func (c *Collector) mailboxName(upn string) string {
+	if !c.settings.ScrambleNames {
+		return upn
+	}
+
+	return util.ScrambleName(upn, c.settings.ScrambleSalt)
+}
+
+// readCSVReport parses a Graph usage report into one map per row, keyed by the column names of the header. The
+// reports start with a byte order mark.
+func readCSVReport(content []byte) ([]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+
+	var rows []map[string]string
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading row: %w", err)
+		}
+
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			row[column] = record[i]
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+// parseNumber parses a number column, empty columns are 0.
+func parseNumber(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q: %w", value, err)
+	}
+
+	return number, nil
+}
@@ -0,0 +1,261 @@
+package exchange
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// mailflowDateLayout is the layout of the dates of Get-MailFlowStatusReport.
+const mailflowDateLayout = "2006-01-02T15:04:05.0000000"
+
+// mailflowRow is a row of a complete day of the mail flow status report.
+type mailflowRow struct {
+	MailFlowResponseRow
+
+	date time.Time
+}
+
+// mailflowSeries identifies a mail flow counter.
+type mailflowSeries struct {
+	Organization string `json:"organization"`
+	Direction    string `json:"direction"`
+	EventType    string `json:"eventType"`
+}
+
+type mailflowCounter struct {
+	mailflowSeries
+
+	Total float64 `json:"total"`
+	// Days are the counts already added to Total by date, days which left the report are removed.
+	Days map[string]float64 `json:"days"`
+}
+
+// mailflowState is the content of the state file.
+type mailflowState struct {
+	Series []*mailflowCounter `json:"series"`
+}
+
+// mailflowCounters sums up the messages of all days of the mail flow report. The count of a day is added once, a
+// later correction adds the difference. Decreases are ignored, counters can't go down.
+type mailflowCounters struct {
+	mu sync.Mutex
+
+	// path of the state file, the counters are kept in memory only if empty.
+	path   string
+	loaded bool
+	series map[mailflowSeries]*mailflowCounter
+}
+
+func newMailflowCounters(path string) *mailflowCounters {
+	return &mailflowCounters{
+		path:   path,
+		series: make(map[mailflowSeries]*mailflowCounter),
+	}
+}
+
+// mailflowDailyMetrics returns the count of every complete day of the report, labeled with the day and with the day as
+// timestamp. Prometheus rejects a different value for a timestamp it already has, so corrections of a day only show up
+// in the counters.
+func (c *Collector) mailflowDailyMetrics(rows []mailflowRow) []prometheus.Metric {
+	type day struct {
+		mailflowSeries
+
+		date time.Time
+	}
+
+	// a duplicate row of a day replaces the earlier one, a series can only have one sample per scrape
+	days := make(map[day]mailflowRow, len(rows))
+
+	for _, row := range rows {
+		days[day{mailflowSeries: mailflowSeries{Organization: row.Organization, Direction: row.Direction, EventType: row.EventType}, date: row.date}] = row
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(days))
+
+	for _, row := range days {
+		metrics = append(metrics, prometheus.NewMetricWithTimestamp(row.date, prometheus.MustNewConstMetric(
+			c.mailflowDailyDesc,
+			prometheus.GaugeValue,
+			float64(row.MessageCount),
+			row.Organization,
+			row.Direction,
+			row.EventType,
+			row.date.Format(time.DateOnly),
+		)))
+	}
+
+	return metrics
+}
+
+// mailflowCounterMetrics adds rows to the counters and returns them. Errors of the state file are logged, the counters
+// in memory are still valid.
+func (c *Collector) mailflowCounterMetrics(rows []mailflowRow) ([]prometheus.Metric, error) {
+	counters, err := c.mailflowCounters.add(rows)
+
+	metrics := make([]prometheus.Metric, 0, len(counters))
+
+	for _, counter := range counters {
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.mailflowTotalDesc,
+			prometheus.CounterValue,
+			counter.Total,
+			counter.Organization,
+			counter.Direction,
+			counter.EventType,
+		))
+	}
+
+	return metrics, err
+}
+
+// add adds rows to the counters and returns a copy of them. The state file is read on first use and written if a
+// counter changed.
+func (m *mailflowCounters) add(rows []mailflowRow) ([]mailflowCounter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := make([]error, 0)
+
+	if !m.loaded {
+		m.loaded = true
+
+		err := m.load()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("counters start at 0: %w", err))
+		}
+	}
+
+	changed := false
+	oldest := ""
+
+	for _, row := range rows {
+		series := mailflowSeries{Organization: row.Organization, Direction: row.Direction, EventType: row.EventType}
+
+		counter, ok := m.series[series]
+		if !ok {
+			counter = &mailflowCounter{mailflowSeries: series, Days: make(map[string]float64)}
+			m.series[series] = counter
+		}
+
+		day := row.date.Format(time.DateOnly)
+		if oldest == "" || day < oldest {
+			oldest = day
+		}
+
+		if count := float64(row.MessageCount); count > counter.Days[day] {
+			counter.Total += count - counter.Days[day]
+			counter.Days[day] = count
+			changed = true
+		}
+	}
+
+	// days before the oldest day of the report can't be corrected anymore
+	for _, counter := range m.series {
+		for day := range counter.Days {
+			if oldest != "" && day < oldest {
+				delete(counter.Days, day)
+
+				changed = true
+			}
+		}
+	}
+
+	if changed && m.path != "" {
+		err := m.save()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	counters := make([]mailflowCounter, 0, len(m.series))
+	for _, counter := range m.series {
+		counters = append(counters, *counter)
+	}
+
+	return counters, errors.Join(errs...)
+}
+
+func (m *mailflowCounters) load() error {
+	if m.path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(m.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("error reading mail flow state: %w", err)
+	}
+
+	var state mailflowState
+
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return fmt.Errorf("error parsing mail flow state %s: %w", m.path, err)
+	}
+
+	for _, counter := range state.Series {
+		if counter.Days == nil {
+			counter.Days = make(map[string]float64)
+		}
+
+		m.series[counter.mailflowSeries] = counter
+	}
+
+	return nil
+}
+
+// save replaces the state file, a temporary file is renamed to avoid a partially written state on a crash.
+func (m *mailflowCounters) save() error {
+	state := mailflowState{Series: make([]*mailflowCounter, 0, len(m.series))}
+	for _, counter := range m.series {
+		state.Series = append(state.Series, counter)
+	}
+
+	slices.SortFunc(state.Series, func(a, b *mailflowCounter) int {
+		return cmp.Or(
+			cmp.Compare(a.Organization, b.Organization),
+			cmp.Compare(a.Direction, b.Direction),
+			cmp.Compare(a.EventType, b.EventType),
+		)
+	})
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error encoding mail flow state: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing mail flow state: %w", err)
+	}
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), m.path)
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+
+		return fmt.Errorf("error writing mail flow state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package exchange_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/exchange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector_ScrapeMetrics_MailflowCounter(t *testing.T) {
+	t.Parallel()
+
+	// the report moves by one day and corrects the count of 2025-06-02
+	responses := []string{
+		`{"value":[
+			{"Organization":"contoso.onmicrosoft.com","Date":"2025-06-01T00:00:00.0000000","EventType":"GoodMail","Direction":"Inbound","MessageCount":900},
+			{"Organization":"contoso.onmicrosoft.com","Date":"2025-06-02T00:00:00.0000000","EventType":"GoodMail","Direction":"Inbound","MessageCount":1200}
+		]}`,
+		`{"value":[
+			{"Organization":"contoso.onmicrosoft.com","Date":"2025-06-02T00:00:00.0000000","EventType":"GoodMail","Direction":"Inbound","MessageCount":1250},
+			{"Organization":"contoso.onmicrosoft.com","Date":"2025-06-03T00:00:00.0000000","EventType":"GoodMail","Direction":"Inbound","MessageCount":700}
+		]}`,
+	}
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		response := responses[min(int(requests.Add(1))-1, len(responses)-1)]
+
+		_, _ = io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+
+	// TODO: Go 1.24: Change to slog.NewDiscardHandler
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	settings := exchange.Settings{
+		MailflowCounter:   true,
+		MailflowStateFile: filepath.Join(t.TempDir(), "mailflow.json"),
+	}
+
+	scrape := func(collector *exchange.Collector) string {
+		t.Helper()
+
+		// TODO: Go 1.24: Change to t.Context()
+		metrics, err := collector.ScrapeMetrics(context.Background())
+		require.NoError(t, err)
+
+		text, err := testutil.MetricsToText(t, metrics)
+		require.NoError(t, err)
+
+		return text
+	}
+
+	const series = `m365_exchange_mailflow_messages_total{direction="Inbound",event_type="GoodMail",organization="contoso.onmicrosoft.com",tenant="contoso.onmicrosoft.com"}`
+
+	collector := exchange.NewCollector(logger, "contoso.onmicrosoft.com", nil, server.Client(), cloud.Environment{ExchangeEndpoint: server.URL}, settings)
+
+	assert.Contains(t, scrape(collector), series+" 2100")
+	assert.Contains(t, scrape(collector), series+" 2850")
+
+	// a restarted collector continues from the state file and doesn't add the days again
+	restarted := exchange.NewCollector(logger, "contoso.onmicrosoft.com", nil, server.Client(), cloud.Environment{ExchangeEndpoint: server.URL}, settings)
+
+	assert.Contains(t, scrape(restarted), series+" 2850")
+}
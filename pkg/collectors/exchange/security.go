@@ -0,0 +1,252 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Directions of the connector metrics.
+const (
+	directionInbound  = "inbound"
+	directionOutbound = "outbound"
+)
+
+const (
+	// dnsTimeout limits a single DNS lookup.
+	dnsTimeout = 5 * time.Second
+	// dnsConcurrency is the number of domains whose records are looked up in parallel.
+	dnsConcurrency = 8
+	// dnsBudget limits all DNS lookups of a scrape, unresponsive name servers must leave time for the other sections.
+	dnsBudget = 10 * time.Second
+)
+
+// legacyDatePattern matches dates serialized as /Date(1700000000000)/.
+var legacyDatePattern = regexp.MustCompile(`^/Date\((-?\d+)\)/$`)
+
+// Resolver looks up the TXT records of the SPF and DMARC checks, it is implemented by *net.Resolver.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+type inboundConnector struct {
+	Name       string `json:"Name"`
+	Enabled    bool   `json:"Enabled"`
+	RequireTLS bool   `json:"RequireTls"`
+}
+
+type outboundConnector struct {
+	Name    string `json:"Name"`
+	Enabled bool   `json:"Enabled"`
+	// TLSSettings is e.g. EncryptionOnly or DomainValidation, empty if TLS is opportunistic.
+	TLSSettings string `json:"TlsSettings"`
+}
+
+type acceptedDomain struct {
+	DomainName string `json:"DomainName"`
+	DomainType string `json:"DomainType"`
+}
+
+type dkimSigningConfig struct {
+	Domain       string `json:"Domain"`
+	Enabled      bool   `json:"Enabled"`
+	Status       string `json:"Status"`
+	RotateOnDate string `json:"RotateOnDate"`
+}
+
+// NewResolver returns a resolver sending its queries to server, e.g. 10.0.0.53:53, or the resolver of the system if
+// server is empty.
+func NewResolver(server string) Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// scrapeMailSecurity returns the connector, accepted domain, DKIM, SPF and DMARC metrics.
+func (c *Collector) scrapeMailSecurity(ctx context.Context) ([]prometheus.Metric, error) {
+	inbound, err := invokeCmdlet[inboundConnector](ctx, c, "Get-InboundConnector", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	outbound, err := invokeCmdlet[outboundConnector](ctx, c, "Get-OutboundConnector", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	domains, err := invokeCmdlet[acceptedDomain](ctx, c, "Get-AcceptedDomain", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dkimConfigs, err := invokeCmdlet[dkimSigningConfig](ctx, c, "Get-DkimSigningConfig", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]prometheus.Metric, 0, 2*len(inbound)+2*len(outbound)+3*len(domains)+3*len(dkimConfigs))
+
+	for _, connector := range inbound {
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(c.connectorEnabledDesc, prometheus.GaugeValue, boolToFloat64(connector.Enabled), directionInbound, connector.Name),
+			prometheus.MustNewConstMetric(c.connectorTLSDesc, prometheus.GaugeValue, boolToFloat64(connector.RequireTLS), directionInbound, connector.Name),
+		)
+	}
+
+	for _, connector := range outbound {
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(c.connectorEnabledDesc, prometheus.GaugeValue, boolToFloat64(connector.Enabled), directionOutbound, connector.Name),
+			prometheus.MustNewConstMetric(c.connectorTLSDesc, prometheus.GaugeValue, boolToFloat64(connector.TLSSettings != ""), directionOutbound, connector.Name),
+		)
+	}
+
+	domainTypes := make(map[string]int)
+
+	for _, domain := range domains {
+		domainTypes[domain.DomainType]++
+	}
+
+	metrics = append(metrics, c.scrapeDNSRecords(ctx, domains)...)
+
+	for domainType, count := range domainTypes {
+		metrics = append(metrics, prometheus.MustNewConstMetric(c.acceptedDomainsDesc, prometheus.GaugeValue, float64(count), domainType))
+	}
+
+	for _, config := range dkimConfigs {
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(c.dkimEnabledDesc, prometheus.GaugeValue, boolToFloat64(config.Enabled), config.Domain),
+			prometheus.MustNewConstMetric(c.dkimStatusDesc, prometheus.GaugeValue, 1, config.Domain, config.Status),
+		)
+
+		rotated, err := parseExchangeTime(config.RotateOnDate)
+		if err != nil {
+			c.logger.WarnContext(ctx, "skipping invalid DKIM rotation date", slog.String("domain", config.Domain), slog.Any("err", err))
+
+			continue
+		}
+
+		if !rotated.IsZero() {
+			metrics = append(metrics, prometheus.MustNewConstMetric(c.dkimRotationDesc, prometheus.GaugeValue, float64(rotated.Unix()), config.Domain))
+		}
+	}
+
+	return metrics, nil
+}
+
+// scrapeDNSRecords looks up the SPF and DMARC records of domains in parallel. Domains which are not looked up within
+// dnsBudget are logged and skipped.
+func (c *Collector) scrapeDNSRecords(ctx context.Context, domains []acceptedDomain) []prometheus.Metric {
+	ctx, cancel := context.WithTimeout(ctx, dnsBudget)
+	defer cancel()
+
+	results, err := abstract.ForEach(ctx, dnsConcurrency, domains, func(ctx context.Context, domain acceptedDomain) ([]prometheus.Metric, error) {
+		return c.dnsMetrics(ctx, domain.DomainName), nil
+	})
+	if err != nil {
+		c.logger.WarnContext(ctx, "DNS lookups exceeded their time budget, skipping the remaining domains", slog.Any("err", err))
+	}
+
+	return slices.Concat(results...)
+}
+
+// dnsMetrics returns whether domain has an SPF and a DMARC record. Lookups which fail for other reasons than a missing
+// record are logged and skipped, they shouldn't hide the Exchange metrics.
+func (c *Collector) dnsMetrics(ctx context.Context, domain string) []prometheus.Metric {
+	metrics := make([]prometheus.Metric, 0, 2)
+
+	for _, check := range []struct {
+		desc   *prometheus.Desc
+		name   string
+		prefix string
+	}{
+		{desc: c.spfRecordDesc, name: domain, prefix: "v=spf1"},
+		{desc: c.dmarcRecordDesc, name: "_dmarc." + domain, prefix: "v=DMARC1"},
+	} {
+		found, err := c.hasTXTRecord(ctx, check.name, check.prefix)
+		if err != nil {
+			c.logger.WarnContext(ctx, "failed to look up DNS record", slog.String("name", check.name), slog.Any("err", err))
+
+			continue
+		}
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(check.desc, prometheus.GaugeValue, boolToFloat64(found), domain))
+	}
+
+	return metrics
+}
+
+func (c *Collector) hasTXTRecord(ctx context.Context, name, prefix string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+
+	records, err := c.settings.Resolver.LookupTXT(ctx, name)
+
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) && dnsError.IsNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error looking up TXT records of %s: %w", name, err)
+	}
+
+	for _, record := range records {
+		if len(record) >= len(prefix) && strings.EqualFold(record[:len(prefix)], prefix) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// parseExchangeTime parses the dates of the admin API, which are either ISO 8601 or /Date(milliseconds)/. An empty
+// value is the zero time.
+func parseExchangeTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if match := legacyDatePattern.FindStringSubmatch(value); match != nil {
+		milliseconds, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q: %w", value, err)
+		}
+
+		return time.UnixMilli(milliseconds), nil
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, mailflowDateLayout} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+func boolToFloat64(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,159 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// zapReportPeriod is the period of the ZAP report, the latest complete day is reported.
+	zapReportPeriod = 7 * 24 * time.Hour
+	// messageTracePeriod is the period of the failed message trace count.
+	messageTracePeriod = 24 * time.Hour
+	// messageTraceResultSize is the maximum number of results of Get-MessageTraceV2.
+	messageTraceResultSize = 5000
+	// quarantinePageSize is the maximum page size of Get-QuarantineMessage, which pages with its Page parameter.
+	quarantinePageSize = 1000
+	// quarantineMaxPages limits the number of quarantined messages read per scrape.
+	quarantineMaxPages = 20
+)
+
+type quarantineMessage struct {
+	QuarantineTypes string `json:"QuarantineTypes"`
+	ReleaseStatus   string `json:"ReleaseStatus"`
+}
+
+type zapReportRow struct {
+	Date         string `json:"Date"`
+	EventType    string `json:"EventType"`
+	MessageCount int    `json:"MessageCount"`
+}
+
+type messageTrace struct {
+	Status string `json:"Status"`
+}
+
+// scrapeQuarantine returns the number of quarantined messages by type and release status. The counts are truncated if
+// the quarantine has more than quarantineMaxPages pages.
+func (c *Collector) scrapeQuarantine(ctx context.Context) ([]prometheus.Metric, error) {
+	var messages []quarantineMessage
+
+	truncated := true
+
+	for page := 1; page <= quarantineMaxPages; page++ {
+		pageMessages, err := invokeCmdlet[quarantineMessage](ctx, c, "Get-QuarantineMessage", map[string]any{
+			"PageSize": quarantinePageSize,
+			"Page":     page,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, pageMessages...)
+
+		if len(pageMessages) < quarantinePageSize {
+			truncated = false
+
+			break
+		}
+	}
+
+	type key struct {
+		quarantineType string
+		releaseStatus  string
+	}
+
+	counts := make(map[key]int)
+	for _, message := range messages {
+		counts[key{quarantineType: message.QuarantineTypes, releaseStatus: message.ReleaseStatus}]++
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(counts)+1)
+
+	for k, count := range counts {
+		metrics = append(metrics, prometheus.MustNewConstMetric(c.quarantineDesc, prometheus.GaugeValue, float64(count), k.quarantineType, k.releaseStatus))
+	}
+
+	return append(metrics, prometheus.MustNewConstMetric(c.quarantineTruncatedDesc, prometheus.GaugeValue, boolToFloat64(truncated))), nil
+}
+
+// scrapeZAP returns the number of delivered messages which were removed by zero-hour auto purge on the most recent
+// complete day, by type.
+func (c *Collector) scrapeZAP(ctx context.Context) ([]prometheus.Metric, error) {
+	now := time.Now().UTC()
+
+	rows, err := invokeCmdlet[zapReportRow](ctx, c, "Get-AggregateZapReport", map[string]any{
+		"StartDate": now.Add(-zapReportPeriod).Format(time.RFC3339),
+		"EndDate":   now.Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var lastDate time.Time
+
+	counts := make(map[time.Time]map[string]int)
+
+	for _, row := range rows {
+		date, err := parseExchangeTime(row.Date)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ZAP report date: %w", err)
+		}
+
+		// Skip "today", because the data is incomplete.
+		if date.After(now.Add(-24 * time.Hour)) {
+			continue
+		}
+
+		if counts[date] == nil {
+			counts[date] = make(map[string]int)
+		}
+
+		counts[date][row.EventType] += row.MessageCount
+
+		if date.After(lastDate) {
+			lastDate = date
+		}
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(counts[lastDate]))
+
+	for eventType, count := range counts[lastDate] {
+		metrics = append(metrics, prometheus.MustNewConstMetric(c.zapMessagesDesc, prometheus.GaugeValue, float64(count), eventType))
+	}
+
+	return metrics, nil
+}
+
+// scrapeMessageTrace returns the number of messages which failed in the last 24 hours. The count is truncated if it
+// reaches messageTraceResultSize.
+func (c *Collector) scrapeMessageTrace(ctx context.Context) ([]prometheus.Metric, error) {
+	now := time.Now().UTC()
+
+	traces, err := invokeCmdlet[messageTrace](ctx, c, "Get-MessageTraceV2", map[string]any{
+		"StartDate":  now.Add(-messageTracePeriod).Format(time.RFC3339),
+		"EndDate":    now.Format(time.RFC3339),
+		"Status":     "Failed",
+		"ResultSize": messageTraceResultSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	failed := 0
+
+	for _, trace := range traces {
+		if strings.EqualFold(trace.Status, "Failed") {
+			failed++
+		}
+	}
+
+	return []prometheus.Metric{
+		prometheus.MustNewConstMetric(c.messageTraceFailedDesc, prometheus.GaugeValue, float64(failed)),
+		prometheus.MustNewConstMetric(c.messageTraceTruncatedDesc, prometheus.GaugeValue, boolToFloat64(len(traces) >= messageTraceResultSize)),
+	}, nil
+}
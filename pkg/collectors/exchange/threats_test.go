@@ -0,0 +1,111 @@
+package exchange_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/exchange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector_ScrapeMetrics_MessageTraceTruncated(t *testing.T) {
+	t.Parallel()
+
+	// TODO: Go 1.24: Change to slog.NewDiscardHandler
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	traces := make([]map[string]string, 5000)
+	for i := range traces {
+		traces[i] = map[string]string{"Status": "Failed"}
+	}
+
+	server := fakegraph.New(t)
+	server.Handle(http.MethodPost, "/adminapi/beta/contoso.onmicrosoft.com/InvokeCommand", fakegraph.Response{Body: map[string]any{"value": []any{}}})
+	server.Handle(http.MethodPost, "/adminapi/beta/contoso.onmicrosoft.com/InvokeCommand/Get-MessageTraceV2", fakegraph.Response{Body: map[string]any{"value": traces}})
+
+	collector := exchange.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(t), server.Client(), server.Environment(), exchange.Settings{MessageTrace: true})
+
+	// TODO: Go 1.24: Change to t.Context()
+	metrics, err := collector.ScrapeMetrics(context.Background())
+	require.NoError(t, err)
+
+	text, err := testutil.MetricsToText(t, metrics)
+	require.NoError(t, err)
+
+	assert.Contains(t, text, `m365_exchange_message_trace_failed_messages{tenant="contoso.onmicrosoft.com"} 5000`)
+	assert.Contains(t, text, `m365_exchange_message_trace_truncated{tenant="contoso.onmicrosoft.com"} 1`)
+}
+
+func TestCollector_ScrapeMetrics_QuarantinePages(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		lastPage      int
+		wantCount     string
+		wantTruncated string
+	}{
+		"complete":  {lastPage: 3, wantCount: "2003", wantTruncated: "0"},
+		"truncated": {lastPage: 100, wantCount: "20000", wantTruncated: "1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var request struct {
+					CmdletInput struct {
+						CmdletName string         `json:"CmdletName"`
+						Parameters map[string]any `json:"Parameters"`
+					} `json:"CmdletInput"`
+				}
+
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+				if request.CmdletInput.CmdletName != "Get-QuarantineMessage" {
+					_, _ = io.WriteString(w, `{"value":[]}`)
+
+					return
+				}
+
+				assert.InDelta(t, 1000, request.CmdletInput.Parameters["PageSize"], 0)
+
+				// every page but the last one is full
+				size := 1000
+				if page, _ := request.CmdletInput.Parameters["Page"].(float64); int(page) == tc.lastPage {
+					size = 3
+				}
+
+				messages := make([]map[string]string, size)
+				for i := range messages {
+					messages[i] = map[string]string{"QuarantineTypes": "Spam", "ReleaseStatus": "NotReleased"}
+				}
+
+				assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{"value": messages}))
+			}))
+			t.Cleanup(server.Close)
+
+			// TODO: Go 1.24: Change to slog.NewDiscardHandler
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			collector := exchange.NewCollector(logger, "contoso.onmicrosoft.com", nil, server.Client(), cloud.Environment{ExchangeEndpoint: server.URL}, exchange.Settings{Quarantine: true})
+
+			// TODO: Go 1.24: Change to t.Context()
+			metrics, err := collector.ScrapeMetrics(context.Background())
+			require.NoError(t, err)
+
+			text, err := testutil.MetricsToText(t, metrics)
+			require.NoError(t, err)
+
+			assert.Contains(t, text, `m365_exchange_quarantine_messages{release_status="NotReleased",tenant="contoso.onmicrosoft.com",type="Spam"} `+tc.wantCount)
+			assert.Contains(t, text, `m365_exchange_quarantine_truncated{tenant="contoso.onmicrosoft.com"} `+tc.wantTruncated)
+		})
+	}
+}
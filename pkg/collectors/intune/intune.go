@@ -2,17 +2,17 @@ package intune
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
 	"github.com/cloudeteer/m365-exporter/pkg/util"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	graphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
@@ -32,8 +32,8 @@ const (
 	vppStatusInvalid               = 3.0
 	vppStatusAssignedToExternalMDM = 4.0
 
-	// URLDepOnboardingSettings DEP Onboarding Settings API URL
-	URLDepOnboardingSettings = "https://graph.microsoft.com/beta/deviceManagement/depOnboardingSettings"
+	// PathDepOnboardingSettings DEP Onboarding Settings API path, relative to the Graph endpoint
+	PathDepOnboardingSettings = "/beta/deviceManagement/depOnboardingSettings"
 )
 
 // Interface guard.
@@ -47,11 +47,6 @@ type depOnboardingSetting struct {
 	TokenName               string    `json:"tokenName"`
 }
 
-// depOnboardingSettingsResponse represents the response from the DEP onboarding settings API
-type depOnboardingSettingsResponse struct {
-	Value []depOnboardingSetting `json:"value"`
-}
-
 type Collector struct {
 	abstract.BaseCollector
 
@@ -64,10 +59,11 @@ type Collector struct {
 	depExpiryDesc  *prometheus.Desc
 	apnExpiryDesc  *prometheus.Desc
 
-	httpClient *http.Client
+	restClient *rest.Client
+	env        cloud.Environment
 }
 
-func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, httpClient *http.Client) *Collector {
+func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, httpClient *http.Client, env cloud.Environment) *Collector {
 	return &Collector{
 		BaseCollector: abstract.NewBaseCollector(msGraphClient, subsystem),
 		logger:        logger.With(slog.String("collector", subsystem)),
@@ -121,7 +117,8 @@ func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.
 			},
 		),
 
-		httpClient: httpClient,
+		restClient: rest.NewClient(httpClient, rest.Settings{Service: util.ServiceGraph}),
+		env:        env,
 	}
 }
 
@@ -129,6 +126,14 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return abstract.GraphPermissions(
+		"DeviceManagementManagedDevices.Read.All",
+		"DeviceManagementServiceConfig.Read.All",
+		"DeviceManagementConfiguration.Read.All",
+	)
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -244,18 +249,17 @@ func (c *Collector) iterateThroughDevices(ctx context.Context, dIterator *graphc
 	osIdentifiers := make(map[string]float64)
 
 	err := dIterator.Iterate(ctx, func(device *models.ManagedDevice) bool {
-		osName := device.GetOperatingSystem()
-		osVersion := device.GetOsVersion()
-
-		if osName == nil || *osName == "" {
-			*osName = unknownValue
+		osName := unknownValue
+		if name := device.GetOperatingSystem(); name != nil && *name != "" {
+			osName = *name
 		}
 
-		if osVersion == nil || *osVersion == "" {
-			*osVersion = unknownValue
+		osVersion := unknownValue
+		if version := device.GetOsVersion(); version != nil && *version != "" {
+			osVersion = *version
 		}
 
-		osIdentifier := *osName + osIdentifierSeparator + *osVersion
+		osIdentifier := osName + osIdentifierSeparator + osVersion
 
 		// map keys are created on the fly
 		osIdentifiers[osIdentifier]++
@@ -380,42 +384,14 @@ func (c *Collector) scrapeVppTokens(ctx context.Context) ([]prometheus.Metric, e
 }
 
 func (c *Collector) scrapeDepOnboardingSettings(ctx context.Context) ([]prometheus.Metric, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, URLDepOnboardingSettings, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
-	}
-
-	defer func() {
-		err := resp.Body.Close()
-		if err != nil {
-			c.logger.ErrorContext(ctx, "error closing response body", slog.Any("err", err))
-		}
-	}()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
-	}
-
-	var depResponse depOnboardingSettingsResponse
-
-	err = json.Unmarshal(body, &depResponse)
+	depSettings, err := rest.GetAll[depOnboardingSetting](ctx, c.restClient, c.env.GraphEndpoint+PathDepOnboardingSettings)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling response: body %s, error %w", string(body), err)
+		return nil, fmt.Errorf("failed to get DEP onboarding settings: %w", err)
 	}
 
-	metrics := make([]prometheus.Metric, 0, len(depResponse.Value))
+	metrics := make([]prometheus.Metric, 0, len(depSettings))
 
-	for _, depSetting := range depResponse.Value {
+	for _, depSetting := range depSettings {
 		// Use Unix timestamp for token expiration
 		expiryValue := float64(depSetting.TokenExpirationDateTime.Unix())
 
@@ -0,0 +1,22 @@
+package intune_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/intune"
+)
+
+func TestCollector_ScrapeMetrics_Golden(t *testing.T) {
+	t.Parallel()
+
+	testutil.RunGolden(t, []testutil.GoldenCase[struct{}]{
+		{Name: "default"},
+		{Name: "nil_fields"},
+		{Name: "partial_failure", WantErr: true},
+	}, func(tb testing.TB, logger *slog.Logger, server *fakegraph.Server, _ struct{}) testutil.Scraper {
+		return intune.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(tb), server.Client(), server.Environment())
+	})
+}
@@ -8,9 +8,10 @@ import (
 	"os"
 	"testing"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/cloudeteer/m365-exporter/internal/testutil"
 	"github.com/cloudeteer/m365-exporter/pkg/auth"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	"github.com/cloudeteer/m365-exporter/pkg/httpclient"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,9 +19,9 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func getMSGraphClient(t *testing.T) (*msgraphsdk.GraphServiceClient, *azidentity.DefaultAzureCredential) {
+func getMSGraphClient(t *testing.T) (*msgraphsdk.GraphServiceClient, azcore.TokenCredential) {
 	httpClient := &http.Client{}
-	msGraphClient, azureCredential, err := auth.NewMSGraphClient(httpClient)
+	msGraphClient, azureCredential, err := auth.NewMSGraphClient(httpClient, cloud.AzurePublic, auth.Settings{})
 	require.NoError(t, err)
 	return msGraphClient, azureCredential
 }
@@ -41,10 +42,10 @@ func TestCollector_scrapeDevices(t *testing.T) {
 
 	msGraphClient, azureCredential := getMSGraphClient(t)
 
-	httpClient := httpclient.New(prometheus.NewRegistry())
-	httpClient.WithAzureCredential(azureCredential)
+	httpClient := httpclient.New(prometheus.NewRegistry(), httpclient.Settings{})
+	httpClient.WithAzureCredential(azureCredential, cloud.AzurePublic)
 
-	collector := NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient())
+	collector := NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient(), cloud.AzurePublic)
 
 	// TODO: Go 1.24: Change to t.Context()
 	metrics, err := collector.scrapeDevices(context.Background())
@@ -75,10 +76,10 @@ func TestCollector_scrapeVppTokens(t *testing.T) {
 
 	msGraphClient, azureCredential := getMSGraphClient(t)
 
-	httpClient := httpclient.New(prometheus.NewRegistry())
-	httpClient.WithAzureCredential(azureCredential)
+	httpClient := httpclient.New(prometheus.NewRegistry(), httpclient.Settings{})
+	httpClient.WithAzureCredential(azureCredential, cloud.AzurePublic)
 
-	collector := NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient())
+	collector := NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient(), cloud.AzurePublic)
 
 	// TODO: Go 1.24: Change to t.Context()
 	metrics, err := collector.scrapeVppTokens(context.Background())
@@ -112,10 +113,10 @@ func TestCollector_scrapeDepOnboardingSettings(t *testing.T) {
 
 	msGraphClient, azureCredential := getMSGraphClient(t)
 
-	httpClient := httpclient.New(prometheus.NewRegistry())
-	httpClient.WithAzureCredential(azureCredential)
+	httpClient := httpclient.New(prometheus.NewRegistry(), httpclient.Settings{})
+	httpClient.WithAzureCredential(azureCredential, cloud.AzurePublic)
 
-	collector := NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient())
+	collector := NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient(), cloud.AzurePublic)
 
 	// TODO: Go 1.24: Change to t.Context()
 	metrics, err := collector.scrapeDepOnboardingSettings(context.Background())
@@ -148,10 +149,10 @@ func TestCollector_scrapeApplePushNotificationCertificate(t *testing.T) {
 
 	msGraphClient, azureCredential := getMSGraphClient(t)
 
-	httpClient := httpclient.New(prometheus.NewRegistry())
-	httpClient.WithAzureCredential(azureCredential)
+	httpClient := httpclient.New(prometheus.NewRegistry(), httpclient.Settings{})
+	httpClient.WithAzureCredential(azureCredential, cloud.AzurePublic)
 
-	collector := NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient())
+	collector := NewCollector(logger, tenantID, msGraphClient, httpClient.GetHTTPClient(), cloud.AzurePublic)
 
 	// TODO: Go 1.24: Change to t.Context()
 	metrics, err := collector.scrapeApplePushNotificationCertificate(context.Background())
@@ -83,6 +83,10 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return abstract.GraphPermissions("Organization.Read.All")
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -170,7 +174,7 @@ func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, err
 
 		for _, group := range groupsResultValues {
 			for _, license := range group.GetAssignedLicenses() {
-				if license.GetSkuId() != result.GetSkuId() {
+				if license.GetSkuId() == nil || result.GetSkuId() == nil || *license.GetSkuId() != *result.GetSkuId() {
 					continue
 				}
 
@@ -2,7 +2,6 @@ package onedrive
 
 import (
 	"context"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -10,6 +9,8 @@ import (
 	"time"
 
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/graphbatch"
+	"github.com/cloudeteer/m365-exporter/pkg/inventory"
 	"github.com/cloudeteer/m365-exporter/pkg/util"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	graphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
@@ -39,6 +40,10 @@ type Collector struct {
 type Settings struct {
 	ScrambleSalt  string
 	ScrambleNames bool
+	// Inventory is used to look up users if set, instead of listing all users on every scrape.
+	Inventory *inventory.Cache
+	// Concurrency is the number of batch requests which are sent in parallel.
+	Concurrency int
 }
 
 func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, settings Settings) *Collector {
@@ -78,6 +83,10 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return abstract.GraphPermissions("User.Read.All", "Files.Read.All")
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -129,6 +138,25 @@ func (c *Collector) scrapeMetricsSites(ctx context.Context) ([]prometheus.Metric
 }
 
 func (c *Collector) scrapeMetricsUsers(ctx context.Context) ([]prometheus.Metric, error) {
+	var (
+		userList []models.Userable
+		err      error
+	)
+
+	if c.settings.Inventory != nil {
+		userList, err = c.settings.Inventory.Users(ctx)
+	} else {
+		userList, err = c.listUsers(ctx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.scrapeUserDrives(ctx, userList)
+}
+
+func (c *Collector) listUsers(ctx context.Context) ([]models.Userable, error) {
 	query := users.UsersRequestBuilderGetQueryParameters{
 		Select: []string{"id", "userPrincipalName"},
 	}
@@ -151,138 +179,204 @@ func (c *Collector) scrapeMetricsUsers(ctx context.Context) ([]prometheus.Metric
 		return nil, fmt.Errorf("failed to create site iterator: %w", util.GetOdataError(err))
 	}
 
-	metrics, err := c.iterateThroughUsers(ctx, uIterator)
+	userList := make([]models.Userable, 0, 100)
+
+	err = uIterator.Iterate(ctx, func(user *models.User) bool {
+		userList = append(userList, user)
+
+		return true
+	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to iterate through users: %w", util.GetOdataError(err))
 	}
 
-	return metrics, nil
+	return userList, nil
 }
 
 func (c *Collector) iterateThroughSites(ctx context.Context, sIterator *graphcore.PageIterator[*models.Site]) ([]prometheus.Metric, error) {
-	metrics := make([]prometheus.Metric, 0, 100)
+	siteList := make([]models.Siteable, 0, 100)
+	requests := make([]graphbatch.Request, 0, 100)
 
-	err := sIterator.Iterate(ctx, func(site *models.Site) bool {
-		// get user onedrive
-		query := sites.ItemDriveRequestBuilderGetQueryParameters{
-			Select: []string{"quota", "driveType"},
-		}
+	// get sites drive
+	query := sites.ItemDriveRequestBuilderGetQueryParameters{
+		Select: []string{"quota", "driveType"},
+	}
+
+	config := sites.ItemDriveRequestBuilderGetRequestConfiguration{
+		QueryParameters: &query,
+	}
+
+	var requestErr error
 
-		config := sites.ItemDriveRequestBuilderGetRequestConfiguration{
-			QueryParameters: &query,
+	err := sIterator.Iterate(ctx, func(site *models.Site) bool {
+		// sometimes this is needed, dont ask me why
+		if site.GetId() == nil || site.GetDisplayName() == nil {
+			return true
 		}
 
-		// we cannot use the error currently b/c an error is returned if the user does not have a drive, it is not possible to filter for sites
-		// which have a drive
-		result, err := c.GraphClient().Sites().BySiteId(*site.GetId()).Drive().Get(ctx, &config)
+		requestInfo, err := c.GraphClient().Sites().BySiteId(*site.GetId()).Drive().ToGetRequestInformation(ctx, &config)
 		if err != nil {
-			c.logger.DebugContext(ctx, "Encountered an error while iterating through sites: %w", slog.Any("err", util.GetOdataError(err)))
+			requestErr = fmt.Errorf("failed to build drive request: %w", err)
 
-			return true
+			return false
 		}
-		// sometimes this is needed, dont ask me why
-		if site.GetDisplayName() == nil {
-			return true
+
+		siteList = append(siteList, site)
+		requests = append(requests, graphbatch.Request{Key: *site.GetId(), Info: requestInfo})
+
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate through sites: %w", util.GetOdataError(err))
+	}
+
+	if requestErr != nil {
+		return nil, requestErr
+	}
+
+	results, err := c.fetchDrives(ctx, requests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch site drives: %w", util.GetOdataError(err))
+	}
+
+	metrics := make([]prometheus.Metric, 0, 100)
+
+	for i, result := range results {
+		// sites without a drive return 404, it is not possible to filter for sites which have a drive
+		if result.Err != nil {
+			c.logDriveError(ctx, "failed to get site drive", result.Err)
+
+			continue
 		}
 
+		site := siteList[i]
+
 		// filter for sharepoint document libraries only
-		dType := *result.GetDriveType()
+		dType := *result.Value.GetDriveType()
 		if dType == "documentLibrary" {
 			owner := *site.GetDisplayName()
 			metrics = append(metrics, prometheus.MustNewConstMetric(
 				c.totalDesc,
 				prometheus.GaugeValue,
-				float64(*result.GetQuota().GetTotal()),
+				float64(*result.Value.GetQuota().GetTotal()),
 				owner, dType, *site.GetId(),
 			))
 
 			metrics = append(metrics, prometheus.MustNewConstMetric(
 				c.deletedOps,
 				prometheus.GaugeValue,
-				float64(*result.GetQuota().GetDeleted()),
+				float64(*result.Value.GetQuota().GetDeleted()),
 				owner, dType, *site.GetId(),
 			))
 
 			metrics = append(metrics, prometheus.MustNewConstMetric(
 				c.usedOpts,
 				prometheus.GaugeValue,
-				float64(*result.GetQuota().GetUsed()),
+				float64(*result.Value.GetQuota().GetUsed()),
 				owner, dType, *site.GetId(),
 			))
 		}
-
-		return true
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to iterate through sites: %w", util.GetOdataError(err))
 	}
 
 	return metrics, nil
 }
 
-func (c *Collector) iterateThroughUsers(ctx context.Context, uIterator *graphcore.PageIterator[*models.User]) ([]prometheus.Metric, error) {
-	metrics := make([]prometheus.Metric, 0, 100)
+func (c *Collector) scrapeUserDrives(ctx context.Context, userList []models.Userable) ([]prometheus.Metric, error) {
+	requests := make([]graphbatch.Request, 0, len(userList))
 
-	err := uIterator.Iterate(ctx, func(user *models.User) bool {
-		// get user onedrive
-		query := users.ItemDriveRequestBuilderGetQueryParameters{
-			Select: []string{"quota", "driveType"},
-		}
+	// get user onedrive
+	query := users.ItemDriveRequestBuilderGetQueryParameters{
+		Select: []string{"quota", "driveType"},
+	}
 
-		config := users.ItemDriveRequestBuilderGetRequestConfiguration{
-			QueryParameters: &query,
-		}
+	config := users.ItemDriveRequestBuilderGetRequestConfiguration{
+		QueryParameters: &query,
+	}
 
-		// we cannot use the error currently b/c an error is returned if the user does not have a drive, it is not possible to filter for users
-		// which have a drive
-		result, err := c.GraphClient().Users().ByUserId(*user.GetId()).Drive().Get(ctx, &config)
+	for _, user := range userList {
+		requestInfo, err := c.GraphClient().Users().ByUserId(*user.GetId()).Drive().ToGetRequestInformation(ctx, &config)
 		if err != nil {
-			c.logger.DebugContext(ctx, "Got an error when getting user drives", slog.Any("err", err))
+			return nil, fmt.Errorf("failed to build drive request: %w", err)
+		}
 
-			return true
+		requests = append(requests, graphbatch.Request{Key: *user.GetId(), Info: requestInfo})
+	}
+
+	results, err := c.fetchDrives(ctx, requests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user drives: %w", util.GetOdataError(err))
+	}
+
+	metrics := make([]prometheus.Metric, 0, 100)
+
+	for i, result := range results {
+		// users without a drive return 404, it is not possible to filter for users which have a drive
+		if result.Err != nil {
+			c.logDriveError(ctx, "failed to get user drive", result.Err)
+
+			continue
 		}
 
 		// errors are so unusable here, that I debug them only
-		if result == nil {
+		if result.Value == nil {
 			c.logger.DebugContext(ctx, "Skipping nil result from getting drives")
 
-			return true
+			continue
 		}
 
-		owner := *user.GetUserPrincipalName()
+		owner := *userList[i].GetUserPrincipalName()
 
 		// scramble username
 		if c.settings.ScrambleNames {
-			owner = owner + "+" + c.settings.ScrambleSalt
-			owner = fmt.Sprintf("%x", sha256.Sum256([]byte(owner)))
+			owner = util.ScrambleName(owner, c.settings.ScrambleSalt)
 		}
 
-		dType := *result.GetDriveType()
+		dType := *result.Value.GetDriveType()
 		metrics = append(metrics, prometheus.MustNewConstMetric(
 			c.totalDesc,
 			prometheus.GaugeValue,
-			float64(*result.GetQuota().GetTotal()),
+			float64(*result.Value.GetQuota().GetTotal()),
 			owner, dType, "",
 		))
 		metrics = append(metrics, prometheus.MustNewConstMetric(
 			c.usedOpts,
 			prometheus.GaugeValue,
-			float64(*result.GetQuota().GetUsed()),
+			float64(*result.Value.GetQuota().GetUsed()),
 			owner, dType, "",
 		))
 		metrics = append(metrics, prometheus.MustNewConstMetric(
 			c.deletedOps,
 			prometheus.GaugeValue,
-			float64(*result.GetQuota().GetDeleted()),
+			float64(*result.Value.GetQuota().GetDeleted()),
 			owner, dType, "",
 		))
+	}
 
-		return true
-	},
+	return metrics, nil
+}
+
+// fetchDrives sends the drive requests as JSON batches, with up to settings.Concurrency batches in parallel.
+func (c *Collector) fetchDrives(ctx context.Context, requests []graphbatch.Request) ([]graphbatch.Result[models.Driveable], error) {
+	chunks := slices.Collect(slices.Chunk(requests, graphbatch.MaxBatchSize))
+
+	results, err := abstract.ForEach(ctx, c.settings.Concurrency, chunks,
+		func(ctx context.Context, chunk []graphbatch.Request) ([]graphbatch.Result[models.Driveable], error) {
+			return graphbatch.Execute[models.Driveable](ctx, c.GraphClient().GetAdapter(), chunk, models.CreateDriveFromDiscriminatorValue, graphbatch.Settings{})
+		},
 	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to iterate through users: %w", util.GetOdataError(err))
+
+	return slices.Concat(results...), err
+}
+
+// logDriveError logs errors of drive requests. Missing drives are expected, other errors are logged as warning.
+func (c *Collector) logDriveError(ctx context.Context, msg string, err error) {
+	err = util.GetOdataError(err)
+
+	if util.IsNotFound(err) {
+		c.logger.DebugContext(ctx, msg, slog.Any("err", err))
+
+		return
 	}
 
-	return metrics, nil
+	c.logger.WarnContext(ctx, msg, slog.Any("err", err))
 }
@@ -0,0 +1,22 @@
+package onedrive_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/onedrive"
+)
+
+func TestCollector_ScrapeMetrics_Golden(t *testing.T) {
+	t.Parallel()
+
+	testutil.RunGolden(t, []testutil.GoldenCase[onedrive.Settings]{
+		{Name: "default"},
+		{Name: "scrambled_names", Fixture: "default", Settings: onedrive.Settings{ScrambleNames: true, ScrambleSalt: "pepper"}},
+		{Name: "partial_failure", WantErr: true},
+	}, func(tb testing.TB, logger *slog.Logger, server *fakegraph.Server, settings onedrive.Settings) testutil.Scraper {
+		return onedrive.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(tb), settings)
+	})
+}
@@ -107,6 +107,10 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return abstract.GraphPermissions("ServiceHealth.Read.All")
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -156,8 +160,11 @@ func (c *Collector) getHealthOverviewMetrics(ctx context.Context) ([]prometheus.
 	for _, result := range results.GetValue() {
 		var foundOrphans bool
 
+		// unknown statuses are parsed as nil
+		statusName := util.EnumString(result.GetStatus())
+
 		for keyStatus, valueStatus := range status {
-			if valueStatus != result.GetStatus().String() {
+			if valueStatus != statusName {
 				continue
 			}
 
@@ -185,7 +192,7 @@ func (c *Collector) getHealthOverviewMetrics(ctx context.Context) ([]prometheus.
 			*result.GetService(), *result.GetId(),
 		))
 
-		c.logger.ErrorContext(ctx, fmt.Sprintf("Service %s has a status that is not tracked. Status is: %s", *result.GetId(), result.GetStatus()))
+		c.logger.ErrorContext(ctx, fmt.Sprintf("Service %s has a status that is not tracked. Status is: %s", *result.GetId(), statusName))
 	}
 
 	return metrics, nil
@@ -215,7 +222,7 @@ func (c *Collector) getHealthIssueMetrics(ctx context.Context) ([]prometheus.Met
 				prometheus.GaugeValue,
 				float64(1),
 				*issue.GetService(),
-				issue.GetClassification().String(),
+				util.EnumString(issue.GetClassification()),
 				strconv.FormatInt(issue.GetStartDateTime().Unix(), 10),
 				*issue.GetTitle(),
 				*issue.GetId(),
@@ -236,11 +243,11 @@ func (c *Collector) getHealthIssueMetrics(ctx context.Context) ([]prometheus.Met
 					prometheus.GaugeValue,
 					float64(0),
 					*issue.GetService(),
-					issue.GetClassification().String(),
+					util.EnumString(issue.GetClassification()),
 					strconv.FormatInt(issue.GetStartDateTime().Unix(), 10),
 					*issue.GetTitle(),
 					*issue.GetId(),
-					strconv.FormatInt(issue.GetEndDateTime().Unix(), 10),
+					strconv.FormatInt(issueCloseTimestamp, 10),
 				))
 			}
 		}
@@ -249,7 +256,7 @@ func (c *Collector) getHealthIssueMetrics(ctx context.Context) ([]prometheus.Met
 		return true
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to iterate through service issues: %w", err)
+		return nil, fmt.Errorf("failed to iterate through service issues: %w", util.GetOdataError(err))
 	}
 
 	return metrics, nil
@@ -0,0 +1,25 @@
+package servicehealth_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/internal/fakegraph"
+	"github.com/cloudeteer/m365-exporter/internal/testutil"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/servicehealth"
+	"github.com/cloudeteer/m365-exporter/pkg/conf"
+	"github.com/spf13/viper"
+)
+
+func TestCollector_ScrapeMetrics_Golden(t *testing.T) {
+	// keep resolved issues of the fixtures, regardless of the current time
+	viper.Set(conf.KeyserviceHealthIssueKeepDays, 100*365)
+
+	testutil.RunGolden(t, []testutil.GoldenCase[struct{}]{
+		{Name: "default"},
+		{Name: "unknown_enums"},
+		{Name: "issues_forbidden", WantErr: true},
+	}, func(tb testing.TB, logger *slog.Logger, server *fakegraph.Server, _ struct{}) testutil.Scraper {
+		return servicehealth.NewCollector(logger, "contoso.onmicrosoft.com", server.GraphClient(tb))
+	})
+}
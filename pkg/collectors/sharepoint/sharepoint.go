@@ -2,16 +2,17 @@ package sharepoint
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
+	"github.com/cloudeteer/m365-exporter/pkg/util"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	"github.com/microsoftgraph/msgraph-sdk-go/sites"
 	"github.com/prometheus/client_golang/prometheus"
@@ -30,15 +31,8 @@ type Collector struct {
 
 	sharepointDesc *prometheus.Desc
 
-	httpClient *http.Client
-}
-
-type sharepointError struct {
-	ErrorDescription string `json:"error_description"`
-}
-
-func (a sharepointError) Error() string {
-	return a.ErrorDescription
+	restClient *rest.Client
+	env        cloud.Environment
 }
 
 type sharepointResponse struct {
@@ -53,7 +47,7 @@ type sharepointResponse struct {
 	} `json:"value"`
 }
 
-func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, httpClient *http.Client) *Collector {
+func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, httpClient *http.Client, env cloud.Environment) *Collector {
 	return &Collector{
 		BaseCollector: abstract.NewBaseCollector(msGraphClient, subsystem),
 		logger:        logger.With(slog.String("collector", subsystem)),
@@ -66,7 +60,11 @@ func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.
 				"tenant": tenant,
 			},
 		),
-		httpClient: httpClient,
+		restClient: rest.NewClient(httpClient, rest.Settings{
+			Service: util.ServiceSharePoint,
+			Header:  http.Header{"Odata-Version": {"4.0"}},
+		}),
+		env: env,
 	}
 }
 
@@ -74,6 +72,12 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return append(abstract.GraphPermissions("Sites.Read.All"),
+		abstract.Permission{Resource: abstract.ResourceSharePoint, Name: "Sites.FullControl.All"},
+	)
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -167,7 +171,7 @@ func (c *Collector) findSharepoints(ctx context.Context) ([]string, error) {
 
 	for count := range sharepoints {
 		result := sharepoints[count].GetSiteCollection().GetHostname()
-		hostname := strings.Split(cast.ToString(result), ".sharepoint.com")
+		hostname := strings.Split(cast.ToString(result), "."+c.env.SharePointDomain)
 		sharepointList[0] = hostname[0]
 	}
 
@@ -175,49 +179,15 @@ func (c *Collector) findSharepoints(ctx context.Context) ([]string, error) {
 }
 
 func (c *Collector) getSharepointMetrics(ctx context.Context, sharepoint string) (sharepointResponse, error) {
-	var sharepointResponse sharepointResponse
-
-	sharepointAddress := fmt.Sprintf("https://%s-admin.sharepoint.com/_api/StorageQuotas()?api-version=1.3.2", sharepoint)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sharepointAddress, nil)
-	if err != nil {
-		return sharepointResponse, fmt.Errorf("error creating request: %w", err)
-	}
-
-	req.Header.Set("odata-version", "4.0")
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return sharepointResponse, fmt.Errorf("error sending request: %w", err)
-	}
-
-	defer func() {
-		err := resp.Body.Close()
-		if err != nil {
-			c.logger.ErrorContext(ctx, "error closing response body", slog.Any("err", err))
-		}
-	}()
+	sharepointAddress := c.env.SharePointAdminURL(sharepoint) + "/_api/StorageQuotas()?api-version=1.3.2"
 
-	body, err := io.ReadAll(resp.Body)
+	sharepointResponse, err := rest.GetJSON[sharepointResponse](ctx, c.restClient, sharepointAddress)
 	if err != nil {
-		return sharepointResponse, fmt.Errorf("error reading response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		var sharepointError sharepointError
-
-		err = json.Unmarshal(body, &sharepointError)
-		if err != nil {
-			return sharepointResponse, fmt.Errorf("error unmarshalling response (status %d): %s", resp.StatusCode, body)
-		}
-
-		return sharepointResponse, fmt.Errorf("unexpected status code %d: %w", resp.StatusCode, sharepointError)
+		return sharepointResponse, fmt.Errorf("failed to get storage quotas: %w", err)
 	}
 
-	err = json.Unmarshal(body, &sharepointResponse)
-	if err != nil {
-		return sharepointResponse, fmt.Errorf("error unmarshalling response: body %s, error %w", body, err)
+	if len(sharepointResponse.Value) == 0 {
+		return sharepointResponse, fmt.Errorf("no storage quotas found for %s", sharepoint)
 	}
 
 	return sharepointResponse, nil
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/graphbatch"
+	"github.com/cloudeteer/m365-exporter/pkg/util"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	graphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
@@ -26,9 +29,16 @@ type Collector struct {
 
 	memberDesc *prometheus.Desc
 	ownerDesc  *prometheus.Desc
+
+	settings Settings
+}
+
+type Settings struct {
+	// Concurrency is the number of batch requests which are sent in parallel.
+	Concurrency int
 }
 
-func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient) *Collector {
+func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, settings Settings) *Collector {
 	return &Collector{
 		BaseCollector: abstract.NewBaseCollector(msGraphClient, subsystem),
 		logger:        logger.With(slog.String("collector", subsystem)),
@@ -49,6 +59,7 @@ func NewCollector(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.
 				"tenant": tenant,
 			},
 		),
+		settings: settings,
 	}
 }
 
@@ -56,6 +67,10 @@ func (c *Collector) StartBackgroundWorker(ctx context.Context, interval time.Dur
 	go c.ScrapeWorker(ctx, c.logger, interval, c.ScrapeMetrics)
 }
 
+func (c *Collector) RequiredPermissions() []abstract.Permission {
+	return abstract.GraphPermissions("TeamSettings.Read.All")
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.BaseCollector.Describe(ch)
 
@@ -74,7 +89,7 @@ func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, err
 
 	teamsRequest, err := c.GraphClient().Teams().Get(ctx, request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch teams: %w", err)
+		return nil, fmt.Errorf("failed to fetch teams: %w", util.GetOdataError(err))
 	}
 
 	tIterator, err := graphcore.NewPageIterator[*models.Team](
@@ -83,7 +98,7 @@ func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, err
 		models.CreateTeamCollectionResponseFromDiscriminatorValue,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch page iterator: %w", err)
+		return nil, fmt.Errorf("failed to fetch page iterator: %w", util.GetOdataError(err))
 	}
 
 	metrics, err := c.iterateThroughTeams(ctx, tIterator)
@@ -95,41 +110,86 @@ func (c *Collector) ScrapeMetrics(ctx context.Context) ([]prometheus.Metric, err
 }
 
 func (c *Collector) iterateThroughTeams(ctx context.Context, iterator *graphcore.PageIterator[*models.Team]) ([]prometheus.Metric, error) {
-	metrics := make([]prometheus.Metric, 0, 100)
+	requests := make([]graphbatch.Request, 0, 100)
+
+	var requestErr error
 
 	err := iterator.Iterate(
 		ctx,
 		func(t *models.Team) bool {
-			r := c.GraphClient().Teams().ByTeamId(*t.GetId())
-
-			team, err := r.Get(ctx, nil)
+			requestInfo, err := c.GraphClient().Teams().ByTeamId(*t.GetId()).ToGetRequestInformation(ctx, nil)
 			if err != nil {
+				requestErr = fmt.Errorf("failed to build team request: %w", err)
+
 				return false
 			}
 
-			teamName := *team.GetDisplayName()
+			requests = append(requests, graphbatch.Request{Key: *t.GetId(), Info: requestInfo})
+
+			return true
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate through teams: %w", util.GetOdataError(err))
+	}
 
-			metrics = append(metrics, prometheus.MustNewConstMetric(
-				c.memberDesc,
-				prometheus.GaugeValue,
-				float64(*team.GetSummary().GetMembersCount()),
-				teamName,
-				*team.GetId(),
-			))
+	if requestErr != nil {
+		return nil, requestErr
+	}
 
-			metrics = append(metrics, prometheus.MustNewConstMetric(
-				c.ownerDesc,
-				prometheus.GaugeValue,
-				float64(*team.GetSummary().GetOwnersCount()),
-				teamName,
-				*team.GetId(),
-			))
+	chunks := slices.Collect(slices.Chunk(requests, graphbatch.MaxBatchSize))
 
-			return true
+	chunkResults, err := abstract.ForEach(ctx, c.settings.Concurrency, chunks,
+		func(ctx context.Context, chunk []graphbatch.Request) ([]graphbatch.Result[models.Teamable], error) {
+			return graphbatch.Execute[models.Teamable](ctx, c.GraphClient().GetAdapter(), chunk, models.CreateTeamFromDiscriminatorValue, graphbatch.Settings{})
 		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to iterate through teams: %w", err)
+		return nil, fmt.Errorf("failed to fetch teams: %w", util.GetOdataError(err))
+	}
+
+	results := slices.Concat(chunkResults...)
+
+	metrics := make([]prometheus.Metric, 0, 100)
+
+	for _, result := range results {
+		if result.Err != nil {
+			c.logger.WarnContext(ctx, "failed to fetch team",
+				slog.String("team_id", result.Key),
+				slog.Any("err", util.GetOdataError(result.Err)),
+			)
+
+			continue
+		}
+
+		team := result.Value
+		summary := team.GetSummary()
+
+		if team.GetDisplayName() == nil || summary == nil || summary.GetMembersCount() == nil || summary.GetOwnersCount() == nil {
+			c.logger.WarnContext(ctx, "team has no display name or member summary",
+				slog.String("team_id", result.Key),
+			)
+
+			continue
+		}
+
+		teamName := *team.GetDisplayName()
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.memberDesc,
+			prometheus.GaugeValue,
+			float64(*summary.GetMembersCount()),
+			teamName,
+			result.Key,
+		))
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(
+			c.ownerDesc,
+			prometheus.GaugeValue,
+			float64(*summary.GetOwnersCount()),
+			teamName,
+			result.Key,
+		))
 	}
 
 	return metrics, nil
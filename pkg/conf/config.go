@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
 	v "github.com/spf13/viper"
 )
 
@@ -23,11 +24,79 @@ const (
 	KeyLogLevel                       = "settings.loglevel"
 	KeyServiceHealthStatusRefreshRate = "settings.serviceHealthStatusRefreshRate"
 	KeyserviceHealthIssueKeepDays     = "settings.serviceHealthIssueKeepDays"
+	KeyMissingPermissionAction        = "settings.missingPermissionAction"
 	KeyAzureTenantID                  = "azure.tenantId"
+	KeyAzureCloud                     = "azure.cloud"
+
+	// Credential selection, see auth.Settings.
+	//nolint: godoclint
+	KeyAzureAuthMethod                  = "azure.auth.method"
+	KeyAzureAuthClientID                = "azure.auth.clientId"
+	KeyAzureAuthClientSecret            = "azure.auth.clientSecret"
+	KeyAzureAuthClientSecretFile        = "azure.auth.clientSecretFile"
+	KeyAzureAuthCertificatePath         = "azure.auth.certificatePath"
+	KeyAzureAuthCertificatePasswordFile = "azure.auth.certificatePasswordFile"
+	KeyAzureAuthFederatedTokenFile      = "azure.auth.federatedTokenFile"
+
+	// Outbound request limits.
+	//nolint: godoclint
+	KeyHTTPMaxConcurrentRequests   = "httpclient.limits.global"
+	KeyHTTPGraphMaxConcurrent      = "httpclient.limits.graph"
+	KeyHTTPARMMaxConcurrent        = "httpclient.limits.arm"
+	KeyHTTPExchangeMaxConcurrent   = "httpclient.limits.exchange"
+	KeyHTTPSharePointMaxConcurrent = "httpclient.limits.sharepoint"
+	KeyHTTPRequestsPerSecond       = "httpclient.limits.requestsPerSecond"
+	KeyHTTPRequestsPerSecondBurst  = "httpclient.limits.burst"
+
+	// Outbound proxy, TLS and connection settings, timeouts are in seconds.
+	//nolint: godoclint
+	KeyHTTPProxyURL              = "httpclient.proxy.url"
+	KeyHTTPProxyPasswordFile     = "httpclient.proxy.passwordFile"
+	KeyHTTPNoProxy               = "httpclient.proxy.noProxy"
+	KeyHTTPCAFile                = "httpclient.tls.caFile"
+	KeyHTTPMaxIdleConns          = "httpclient.transport.maxIdleConns"
+	KeyHTTPMaxIdleConnsPerHost   = "httpclient.transport.maxIdleConnsPerHost"
+	KeyHTTPIdleConnTimeout       = "httpclient.transport.idleConnTimeout"
+	KeyHTTPTLSHandshakeTimeout   = "httpclient.transport.tlsHandshakeTimeout"
+	KeyHTTPResponseHeaderTimeout = "httpclient.transport.responseHeaderTimeout"
+
+	// Record sanitized responses to a directory, or replay them instead of sending requests.
+	//nolint: godoclint
+	KeyHTTPRecordDir  = "httpclient.record.dir"
+	KeyHTTPRecordSalt = "httpclient.record.salt"
+	KeyHTTPReplayDir  = "httpclient.replay.dir"
+
+	KeyInventoryEnabled          = "inventory.enabled"
+	KeyInventoryMinSyncInterval  = "inventory.minSyncInterval"
+	KeyInventoryFullSyncInterval = "inventory.fullSyncInterval"
+
+	KeyAdsSyncErrorDetails          = "adsync.errorDetails"
+	KeyAdsSyncErrorDetailsTokenFile = "adsync.errorDetailsTokenFile"
 
 	KeyODriveScrambleNames = "onedrive.scrambleNames"
 	KeyODriveScrambleSalt  = "onedrive.scrambleSalt"
 
+	KeyExchangeMailboxUsage   = "exchange.mailboxUsage"
+	KeyExchangeMailboxDetails = "exchange.mailboxDetails"
+	KeyExchangeScrambleNames  = "exchange.scrambleNames"
+	KeyExchangeCmdlets        = "exchange.cmdlets"
+	KeyExchangeMailSecurity   = "exchange.mailSecurity"
+	KeyExchangeDNSServer      = "exchange.dnsServer"
+
+	KeyExchangeMailflowDaily     = "exchange.mailflowDaily"
+	KeyExchangeMailflowCounter   = "exchange.mailflowCounter"
+	KeyExchangeMailflowStateFile = "exchange.mailflowStateFile"
+
+	KeyExchangeQuarantine   = "exchange.quarantine"
+	KeyExchangeZAP          = "exchange.zap"
+	KeyExchangeMessageTrace = "exchange.messageTrace"
+
+	// Collector concurrency, i.e. the number of parallel workers for per-entity requests.
+	//nolint: godoclint
+	KeyODriveConcurrency  = "onedrive.concurrency"
+	KeyTeamsConcurrency   = "teams.concurrency"
+	KeyAdsSyncConcurrency = "adsync.concurrency"
+
 	// Collector enabled flags.
 	//nolint: godoclint
 	KeyAdsSyncEnabled       = "adsync.enabled"
@@ -44,6 +113,13 @@ const (
 	KeyApplicationFilter    = "application.filter"
 )
 
+// Values of KeyMissingPermissionAction.
+const (
+	MissingPermissionActionWarn    = "warn"
+	MissingPermissionActionDisable = "disable"
+	MissingPermissionActionFail    = "fail"
+)
+
 // required in order to avoid global var.
 func getConfigLocations() []string {
 	return []string{
@@ -58,11 +134,65 @@ func Configure(logger *slog.Logger) error {
 	v.SetDefault(KeyLogLevel, "info")
 	v.SetDefault(KeyServiceHealthStatusRefreshRate, 5)
 	v.SetDefault(KeyserviceHealthIssueKeepDays, 30)
+	v.SetDefault(KeyMissingPermissionAction, MissingPermissionActionWarn)
+
+	// National cloud the tenant lives in, see pkg/cloud for the accepted names
+	v.SetDefault(KeyAzureCloud, "AzurePublic")
+
+	// Credential used to authenticate, "default" probes environment, workload identity, managed identity and the CLI
+	v.SetDefault(KeyAzureAuthMethod, "default")
+
+	// Limit outbound requests to avoid throttling by Microsoft APIs, 0 means unlimited
+	v.SetDefault(KeyHTTPMaxConcurrentRequests, 32)
+	v.SetDefault(KeyHTTPGraphMaxConcurrent, 16)
+	v.SetDefault(KeyHTTPARMMaxConcurrent, 4)
+	v.SetDefault(KeyHTTPExchangeMaxConcurrent, 2)
+	v.SetDefault(KeyHTTPSharePointMaxConcurrent, 2)
+	v.SetDefault(KeyHTTPRequestsPerSecond, 0)
+	v.SetDefault(KeyHTTPRequestsPerSecondBurst, 10)
+
+	// Connection pooling and timeouts of outbound requests, 0 means no response header timeout
+	v.SetDefault(KeyHTTPMaxIdleConns, 100)
+	v.SetDefault(KeyHTTPMaxIdleConnsPerHost, 10)
+	v.SetDefault(KeyHTTPIdleConnTimeout, 90)
+	v.SetDefault(KeyHTTPTLSHandshakeTimeout, 10)
+	v.SetDefault(KeyHTTPResponseHeaderTimeout, 0)
+
+	// Keep users, groups and devices in memory and update them via delta queries (intervals in minutes)
+	v.SetDefault(KeyInventoryEnabled, true)
+	v.SetDefault(KeyInventoryMinSyncInterval, 5)
+	v.SetDefault(KeyInventoryFullSyncInterval, 24*60)
 
 	// Scramble the names of OneDrive Users if data protection is requiring it
 	v.SetDefault(KeyODriveScrambleNames, true)
 	v.SetDefault(KeyODriveScrambleSalt, "NsVfe9cRaH")
 
+	// Mail flow of the latest day with the day as timestamp, or as counters across all days of the report
+	v.SetDefault(KeyExchangeMailflowDaily, false)
+	v.SetDefault(KeyExchangeMailflowCounter, false)
+	v.SetDefault(KeyExchangeMailflowStateFile, "")
+
+	// Mailbox usage of the Graph reports, per mailbox series are opt-in and scrambled with the salt of OneDrive
+	v.SetDefault(KeyExchangeMailboxUsage, true)
+	v.SetDefault(KeyExchangeMailboxDetails, false)
+	v.SetDefault(KeyExchangeScrambleNames, true)
+
+	// Connector, DKIM, SPF and DMARC checks, an empty DNS server uses the resolver of the system
+	v.SetDefault(KeyExchangeMailSecurity, false)
+	v.SetDefault(KeyExchangeDNSServer, "")
+
+	// Quarantine, zero-hour auto purge and message trace need further Exchange roles and are opt-in
+	v.SetDefault(KeyExchangeQuarantine, false)
+	v.SetDefault(KeyExchangeZAP, false)
+	v.SetDefault(KeyExchangeMessageTrace, false)
+
+	// Number of parallel workers used by collectors that fan out per entity
+	v.SetDefault(KeyODriveConcurrency, 4)
+	v.SetDefault(KeyTeamsConcurrency, 4)
+	v.SetDefault(KeyAdsSyncConcurrency, 2)
+	v.SetDefault(KeyAdsSyncErrorDetails, false)
+	v.SetDefault(KeyAdsSyncErrorDetailsTokenFile, "")
+
 	// Set default values for collector enabled flags
 	v.SetDefault(KeyAdsSyncEnabled, true)
 	v.SetDefault(KeyExchangeEnabled, true)
@@ -86,6 +216,11 @@ func Configure(logger *slog.Logger) error {
 		return fmt.Errorf("could not bind environment variable AZURE_TENANT_ID: %w", err)
 	}
 
+	err = v.BindEnv(KeyAzureAuthClientID, "M365_AZURE_AUTH_CLIENTID", "AZURE_CLIENT_ID")
+	if err != nil {
+		return fmt.Errorf("could not bind environment variable AZURE_CLIENT_ID: %w", err)
+	}
+
 	v.SetConfigName("m365-exporter-config")
 	v.SetConfigType("yaml")
 
@@ -119,6 +254,21 @@ func Configure(logger *slog.Logger) error {
 		return fmt.Errorf("missing mandatory config parameter for %s", KeyAzureTenantID)
 	}
 
+	// check if the cloud is known
+	if _, err = cloud.Lookup(v.GetString(KeyAzureCloud)); err != nil {
+		return fmt.Errorf("invalid config parameter %s: %w", KeyAzureCloud, err)
+	}
+
+	if v.GetString(KeyHTTPRecordDir) != "" && v.GetString(KeyHTTPReplayDir) != "" {
+		return fmt.Errorf("invalid config: %s and %s can't be used together", KeyHTTPRecordDir, KeyHTTPReplayDir)
+	}
+
+	switch action := v.GetString(KeyMissingPermissionAction); action {
+	case MissingPermissionActionWarn, MissingPermissionActionDisable, MissingPermissionActionFail:
+	default:
+		return fmt.Errorf("invalid config parameter %s: unknown action %q", KeyMissingPermissionAction, action)
+	}
+
 	// check if service health status refresh rate is an int
 	_, err = strconv.ParseInt(v.GetString(KeyServiceHealthStatusRefreshRate), 10, 64)
 	if err != nil {
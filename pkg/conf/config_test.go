@@ -26,6 +26,7 @@ func Test_ConfigReading(t *testing.T) {
 	t.Run("Test default values", func(t *testing.T) {
 		assert.Equal(t, "8080", viper.Get(conf.KeySrvPort))
 		assert.Equal(t, "", viper.GetString(conf.KeySrvHost))
+		assert.Equal(t, "AzurePublic", viper.GetString(conf.KeyAzureCloud))
 	})
 
 	t.Setenv(envCfg, "./testdata/listen.yaml")
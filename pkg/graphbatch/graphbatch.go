@@ -0,0 +1,254 @@
+// Package graphbatch groups Microsoft Graph requests into JSON batches ($batch).
+//
+// https://learn.microsoft.com/en-us/graph/json-batching
+package graphbatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	"github.com/microsoft/kiota-abstractions-go/serialization"
+	jsonserialization "github.com/microsoft/kiota-serialization-json-go"
+	graphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
+)
+
+const (
+	// MaxBatchSize is the maximum number of requests Microsoft Graph accepts in a single batch.
+	MaxBatchSize = 20
+
+	defaultMaxRetries = 3
+	defaultRetryDelay = 2 * time.Second
+	maxRetryDelay     = time.Minute
+)
+
+// Request is a single Graph request which should be sent as part of a batch.
+type Request struct {
+	// Key identifies the request in the result, e.g. the ID of the user the request belongs to.
+	Key  string
+	Info *abstractions.RequestInformation
+}
+
+// Result is the outcome of a single Request.
+// Err is set if the request failed, e.g. because the requested entity does not exist.
+type Result[T serialization.Parsable] struct {
+	Key   string
+	Value T
+	Err   error
+}
+
+// Settings configures Execute. The zero value uses sensible defaults.
+type Settings struct {
+	// BatchSize is the number of requests per batch, at most MaxBatchSize.
+	BatchSize int
+	// MaxRetries is the number of times a throttled or temporarily failed item is retried.
+	MaxRetries int
+}
+
+// Execute sends requests in batches and returns one result per request, in the order of requests.
+// Items which are throttled (429) or temporarily unavailable (503, 504) are retried in a following batch,
+// honoring the Retry-After header of the item. Other item failures are reported in Result.Err.
+// An error is returned only if a whole batch could not be sent.
+func Execute[T serialization.Parsable](
+	ctx context.Context, adapter abstractions.RequestAdapter, requests []Request, factory serialization.ParsableFactory, settings Settings,
+) ([]Result[T], error) {
+	batchSize := settings.BatchSize
+	if batchSize <= 0 || batchSize > MaxBatchSize {
+		batchSize = MaxBatchSize
+	}
+
+	maxRetries := settings.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	results := make([]Result[T], 0, len(requests))
+
+	for start := 0; start < len(requests); start += batchSize {
+		chunk := requests[start:min(start+batchSize, len(requests))]
+
+		chunkResults, err := executeBatch[T](ctx, adapter, chunk, factory, maxRetries)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, chunkResults...)
+	}
+
+	return results, nil
+}
+
+// executeBatch sends up to MaxBatchSize requests and retries the items which can be retried.
+func executeBatch[T serialization.Parsable](
+	ctx context.Context, adapter abstractions.RequestAdapter, requests []Request, factory serialization.ParsableFactory, maxRetries int,
+) ([]Result[T], error) {
+	results := make([]Result[T], len(requests))
+
+	// indexes of the requests which still have to be sent
+	pending := make([]int, len(requests))
+	for i := range requests {
+		pending[i] = i
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		batch := graphcore.NewBatchRequest(adapter)
+		itemIDs := make(map[int]string, len(pending))
+
+		for _, i := range pending {
+			item, err := batch.AddBatchRequestStep(*requests[i].Info)
+			if err != nil {
+				return nil, fmt.Errorf("adding request %s to batch: %w", requests[i].Key, err)
+			}
+
+			itemIDs[i] = *item.GetId()
+		}
+
+		response, err := batch.Send(ctx, adapter)
+		if err != nil {
+			return nil, fmt.Errorf("sending batch request: %w", err)
+		}
+
+		var (
+			retry      []int
+			retryDelay time.Duration
+		)
+
+		for _, i := range pending {
+			item := response.GetResponseById(itemIDs[i])
+			if item == nil || item.GetStatus() == nil {
+				results[i] = Result[T]{Key: requests[i].Key, Err: fmt.Errorf("no response for request %s in batch", requests[i].Key)}
+
+				continue
+			}
+
+			status := int(*item.GetStatus())
+			if isRetryable(status) && attempt < maxRetries {
+				retry = append(retry, i)
+				retryDelay = max(retryDelay, getRetryDelay(item.GetHeaders()))
+
+				continue
+			}
+
+			if status >= http.StatusBadRequest {
+				results[i] = Result[T]{
+					Key: requests[i].Key,
+					Err: fmt.Errorf("request %s failed with status %d: %w", requests[i].Key, status, parseError(item, status)),
+				}
+
+				continue
+			}
+
+			value, err := parseItem[T](item, factory)
+			if err != nil {
+				err = fmt.Errorf("parsing response of request %s: %w", requests[i].Key, err)
+			}
+
+			results[i] = Result[T]{Key: requests[i].Key, Value: value, Err: err}
+		}
+
+		pending = retry
+
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return results, nil
+}
+
+// parseItem deserializes the body of a successful batch item.
+func parseItem[T serialization.Parsable](item graphcore.BatchItem, factory serialization.ParsableFactory) (T, error) {
+	var value T
+
+	parseNode, err := getParseNode(item)
+	if err != nil {
+		return value, err
+	}
+
+	parsable, err := parseNode.GetObjectValue(factory)
+	if err != nil {
+		return value, fmt.Errorf("deserializing body: %w", err)
+	}
+
+	value, ok := parsable.(T)
+	if !ok {
+		return value, fmt.Errorf("unexpected response type %T", parsable)
+	}
+
+	return value, nil
+}
+
+// parseError converts the body of a failed batch item into an *odataerrors.ODataError,
+// so that it can be handled like errors returned by the SDK.
+func parseError(item graphcore.BatchItem, status int) error {
+	apiError := &abstractions.ApiError{
+		Message:            "the server returned an unexpected status code: " + strconv.Itoa(status),
+		ResponseStatusCode: status,
+	}
+
+	parseNode, err := getParseNode(item)
+	if err != nil {
+		return apiError
+	}
+
+	parsable, err := parseNode.GetObjectValue(odataerrors.CreateODataErrorFromDiscriminatorValue)
+	if err != nil {
+		return apiError
+	}
+
+	odataError, ok := parsable.(*odataerrors.ODataError)
+	if !ok || odataError.GetErrorEscaped() == nil {
+		return apiError
+	}
+
+	odataError.SetStatusCode(status)
+
+	return odataError
+}
+
+func getParseNode(item graphcore.BatchItem) (serialization.ParseNode, error) {
+	content, err := json.Marshal(item.GetBody())
+	if err != nil {
+		return nil, fmt.Errorf("marshalling body: %w", err)
+	}
+
+	parseNode, err := jsonserialization.NewJsonParseNode(content)
+	if err != nil {
+		return nil, fmt.Errorf("creating parse node: %w", err)
+	}
+
+	return parseNode, nil
+}
+
+func isRetryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// getRetryDelay reads the Retry-After header (in seconds) of a batch item.
+func getRetryDelay(headers graphcore.RequestHeader) time.Duration {
+	for key, value := range headers {
+		if http.CanonicalHeaderKey(key) != "Retry-After" {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			break
+		}
+
+		return min(time.Duration(seconds)*time.Second, maxRetryDelay)
+	}
+
+	return defaultRetryDelay
+}
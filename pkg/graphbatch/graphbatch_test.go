@@ -0,0 +1,122 @@
+package graphbatch_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/pkg/graphbatch"
+	"github.com/microsoft/kiota-abstractions-go/authentication"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type batchRequest struct {
+	Requests []struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	} `json:"requests"`
+}
+
+type batchResponseItem struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    any               `json:"body"`
+}
+
+func TestExecute(t *testing.T) {
+	t.Parallel()
+
+	var (
+		throttled atomic.Bool
+		batches   atomic.Int32
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1.0/$batch", r.URL.Path)
+		batches.Add(1)
+
+		var req batchRequest
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		responses := make([]batchResponseItem, 0, len(req.Requests))
+
+		for _, item := range req.Requests {
+			headers := map[string]string{"Content-Type": "application/json"}
+
+			switch {
+			case strings.HasPrefix(item.URL, "/users/missing/"):
+				responses = append(responses, batchResponseItem{
+					ID: item.ID, Status: http.StatusNotFound, Headers: headers,
+					Body: map[string]any{"error": map[string]any{"code": "itemNotFound", "message": "drive not found"}},
+				})
+			case strings.HasPrefix(item.URL, "/users/throttled/") && throttled.CompareAndSwap(false, true):
+				headers["Retry-After"] = "0"
+				responses = append(responses, batchResponseItem{
+					ID: item.ID, Status: http.StatusTooManyRequests, Headers: headers,
+					Body: map[string]any{"error": map[string]any{"code": "TooManyRequests", "message": "slow down"}},
+				})
+			default:
+				responses = append(responses, batchResponseItem{
+					ID: item.ID, Status: http.StatusOK, Headers: headers,
+					Body: map[string]any{"driveType": "business", "quota": map[string]any{"total": 1024, "used": 512}},
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{"responses": responses}))
+	}))
+	defer server.Close()
+
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(
+		&authentication.AnonymousAuthenticationProvider{}, nil, nil, server.Client(),
+	)
+	require.NoError(t, err)
+
+	adapter.SetBaseUrl(server.URL + "/v1.0")
+
+	client := msgraphsdk.NewGraphServiceClient(adapter)
+
+	requests := make([]graphbatch.Request, 0, 3)
+
+	for _, userID := range []string{"ok", "missing", "throttled"} {
+		requestInfo, err := client.Users().ByUserId(userID).Drive().ToGetRequestInformation(context.Background(), nil)
+		require.NoError(t, err)
+
+		requests = append(requests, graphbatch.Request{Key: userID, Info: requestInfo})
+	}
+
+	results, err := graphbatch.Execute[models.Driveable](context.Background(), adapter, requests, models.CreateDriveFromDiscriminatorValue, graphbatch.Settings{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	assert.Equal(t, "ok", results[0].Key)
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "business", *results[0].Value.GetDriveType())
+	assert.Equal(t, int64(512), *results[0].Value.GetQuota().GetUsed())
+
+	assert.Equal(t, "missing", results[1].Key)
+
+	var odataError *odataerrors.ODataError
+
+	require.ErrorAs(t, results[1].Err, &odataError)
+	assert.Equal(t, http.StatusNotFound, odataError.ResponseStatusCode)
+	assert.Equal(t, "itemNotFound", *odataError.GetErrorEscaped().GetCode())
+
+	assert.Equal(t, "throttled", results[2].Key)
+	require.NoError(t, results[2].Err)
+	assert.Equal(t, "business", *results[2].Value.GetDriveType())
+
+	// the throttled item is retried in a second batch
+	assert.Equal(t, int32(2), batches.Load())
+}
@@ -0,0 +1,82 @@
+package httpclient
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// versionSegment matches API versions like v1.0, which contain a dot but are no identifier.
+	versionSegment = regexp.MustCompile(`^v\d+(\.\d+)?$`)
+	guidPattern    = regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	digitsPattern  = regexp.MustCompile(`^\d+$`)
+	// callSegment matches key segments like users('alice@contoso.com') and functions like
+	// getMailboxUsageDetail(period='D7'), only their quoted values can be identifiers.
+	callSegment = regexp.MustCompile(`^[A-Za-z.]+\(.*\)$`)
+	// quotedValue matches a quoted value, the first group is "=" for named parameters and alternate keys.
+	quotedValue = regexp.MustCompile(`(=?)'([^']*)'`)
+	// sharePointHost matches the per-tenant SharePoint hosts of all clouds, e.g. contoso-admin.sharepoint.com.
+	sharePointHost = regexp.MustCompile(`(?i)^[a-z0-9]+((?:-admin|-my)?\.sharepoint(?:-mil)?\.[a-z]+(?::\d+)?)$`)
+)
+
+// maxSegmentLength is the length above which a path segment is considered an opaque identifier, e.g. a drive ID.
+const maxSegmentLength = 32
+
+// normalizeHost replaces the tenant name of SharePoint hosts with {tenant}, e.g. {tenant}-admin.sharepoint.com.
+func normalizeHost(host string) string {
+	return sharePointHost.ReplaceAllString(host, "{tenant}$1")
+}
+
+// normalizePath turns a request path into a template with a bounded number of values, by replacing
+// every segment which looks like an identifier with {id}, e.g. /v1.0/users/{id}/drive. In key and function
+// segments, only quoted values are replaced: keys always, e.g. /v1.0/users({id}), named parameters only if they
+// look like an identifier, so that getMailboxUsageDetail(period='D7') is kept.
+func normalizePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+
+	for i, segment := range segments {
+		switch {
+		case callSegment.MatchString(segment):
+			segments[i] = quotedValue.ReplaceAllStringFunc(segment, func(value string) string {
+				match := quotedValue.FindStringSubmatch(value)
+
+				switch {
+				case match[1] == "":
+					return "{id}"
+				case isIdentifier(match[2]):
+					return "={id}"
+				}
+
+				return value
+			})
+		case isIdentifier(segment):
+			segments[i] = "{id}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func isIdentifier(segment string) bool {
+	switch {
+	case segment == "":
+		return false
+	case guidPattern.MatchString(segment), digitsPattern.MatchString(segment):
+		return true
+	case len(segment) > maxSegmentLength:
+		return true
+	case strings.ContainsAny(segment, "@!:"):
+		// UPNs and drive IDs like b!...
+		return true
+	case strings.Contains(segment, ".") && !versionSegment.MatchString(segment) && !strings.HasPrefix(segment, "Microsoft."):
+		// domains, e.g. the tenant in the Exchange admin API or the name of a sync service,
+		// but not ARM resource provider namespaces
+		return true
+	}
+
+	return false
+}
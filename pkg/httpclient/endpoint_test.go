@@ -0,0 +1,83 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_normalizePath(t *testing.T) {
+	t.Parallel()
+
+	for path, expected := range map[string]string{
+		"":                                    "/",
+		"/v1.0/users/delta()":                 "/v1.0/users/delta()",
+		"/v1.0/users/alice@contoso.com/drive": "/v1.0/users/{id}/drive",
+		"/v1.0/users/8f2a3b4c-1d2e-4f5a-9b8c-7d6e5f4a3b2c/drive": "/v1.0/users/{id}/drive",
+		"/v1.0/drives/b!aBcD/root":                               "/v1.0/drives/{id}/root",
+		"/v1.0/$batch":                                           "/v1.0/$batch",
+		"/beta/deviceManagement/depOnboardingSettings":           "/beta/deviceManagement/depOnboardingSettings",
+		"/adminapi/beta/contoso.onmicrosoft.com/InvokeCommand":   "/adminapi/beta/{id}/InvokeCommand",
+		"/providers/Microsoft.ADHybridHealthService/services/AadSyncService-contoso.onmicrosoft.com/exporterrors/counts": "/providers/Microsoft.ADHybridHealthService/services/{id}/exporterrors/counts",
+		"/_api/StorageQuotas()":                                                 "/_api/StorageQuotas()",
+		"/v1.0/teams/12345":                                                     "/v1.0/teams/{id}",
+		"/v1.0/reports/getMailboxUsageDetail(period='D7')":                      "/v1.0/reports/getMailboxUsageDetail(period='D7')",
+		"/v1.0/sites('root')/drives":                                            "/v1.0/sites({id})/drives",
+		"/v1.0/users('alice@contoso.com')/drive":                                "/v1.0/users({id})/drive",
+		"/v1.0/servicePrincipals(appId='00000003-0000-0000-c000-000000000000')": "/v1.0/servicePrincipals(appId={id})",
+	} {
+		assert.Equal(t, expected, normalizePath(path), path)
+	}
+}
+
+func Test_normalizeHost(t *testing.T) {
+	t.Parallel()
+
+	for host, expected := range map[string]string{
+		"graph.microsoft.com":                 "graph.microsoft.com",
+		"contoso-admin.sharepoint.com":        "{tenant}-admin.sharepoint.com",
+		"contoso.sharepoint.com":              "{tenant}.sharepoint.com",
+		"contoso-my.sharepoint.us":            "{tenant}-my.sharepoint.us",
+		"contoso-admin.sharepoint.cn":         "{tenant}-admin.sharepoint.cn",
+		"contoso-admin.sharepoint-mil.us:443": "{tenant}-admin.sharepoint-mil.us:443",
+	} {
+		assert.Equal(t, expected, normalizeHost(host), host)
+	}
+}
+
+func Test_EndpointAndCollectorLabels(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewRegistry()
+	httpClient := New(reg, Settings{})
+
+	ctx := abstract.WithCollector(context.Background(), "onedrive")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1.0/users/alice@contoso.com/drive", nil)
+	require.NoError(t, err)
+
+	resp, err := httpClient.GetHTTPClient().Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	expected := `
+# HELP http_client_requests_total Tracks the number of HTTP requests.
+# TYPE http_client_requests_total counter
+http_client_requests_total{code="200",collector="onedrive",endpoint="/v1.0/users/{id}/drive",host="` + req.Host + `",method="get"} 1
+`
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "http_client_requests_total"))
+}
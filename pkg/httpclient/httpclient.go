@@ -4,10 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/cloudeteer/m365-exporter/pkg/cloud"
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -22,27 +23,37 @@ func (rt roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
 	return rt(r)
 }
 
-type ctxHostValue struct{}
+type (
+	ctxHostValue     struct{}
+	ctxEndpointValue struct{}
+)
 
 type HTTPClient struct {
 	client *http.Client
 }
 
-func New(reg *prometheus.Registry) HTTPClient {
+// Settings configures the HTTP client returned by New.
+type Settings struct {
+	Limits Limits
+	// Transport sends the requests, defaults to http.DefaultTransport. See NewTransport.
+	Transport http.RoundTripper
+}
+
+func New(reg *prometheus.Registry, settings Settings) HTTPClient {
 	histVec := prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "http_client_request_duration_seconds",
 			Help:    "Tracks the latencies for HTTP requests.",
 			Buckets: []float64{0.1, 0.3, 0.6, 1, 3, 6, 9, 20},
 		},
-		[]string{"method", "host", "code"},
+		[]string{"method", "host", "code", "endpoint", "collector"},
 	)
 
 	counter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_client_requests_total",
 			Help: "Tracks the number of HTTP requests.",
-		}, []string{"method", "host", "code"},
+		}, []string{"method", "host", "code", "endpoint", "collector"},
 	)
 
 	inFlightGauge := prometheus.NewGauge(
@@ -52,7 +63,7 @@ func New(reg *prometheus.Registry) HTTPClient {
 		},
 	)
 
-	opts := promhttp.WithLabelFromCtx("host",
+	hostOpt := promhttp.WithLabelFromCtx("host",
 		func(ctx context.Context) string {
 			if val, ok := ctx.Value(ctxHostValue{}).(string); ok {
 				return val
@@ -62,52 +73,73 @@ func New(reg *prometheus.Registry) HTTPClient {
 		},
 	)
 
+	endpointOpt := promhttp.WithLabelFromCtx("endpoint",
+		func(ctx context.Context) string {
+			if val, ok := ctx.Value(ctxEndpointValue{}).(string); ok {
+				return val
+			}
+
+			return "unknown"
+		},
+	)
+
+	collectorOpt := promhttp.WithLabelFromCtx("collector",
+		func(ctx context.Context) string {
+			if val, ok := abstract.CollectorFromContext(ctx); ok {
+				return val
+			}
+
+			// e.g. token requests or the permission check at startup
+			return "none"
+		},
+	)
+
 	reg.MustRegister(counter, histVec, inFlightGauge)
 
+	transport := settings.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
 	hostRoundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
-		ctx := context.WithValue(req.Context(), ctxHostValue{}, req.Host)
+		ctx := context.WithValue(req.Context(), ctxHostValue{}, normalizeHost(req.Host))
+		ctx = context.WithValue(ctx, ctxEndpointValue{}, normalizePath(req.URL.Path))
 
-		return http.DefaultTransport.RoundTrip(req.WithContext(ctx))
+		return transport.RoundTrip(req.WithContext(ctx))
 	})
 
+	instrumentedRoundTripper := promhttp.InstrumentRoundTripperInFlight(inFlightGauge,
+		promhttp.InstrumentRoundTripperCounter(counter,
+			promhttp.InstrumentRoundTripperDuration(histVec,
+				hostRoundTripper,
+				hostOpt, endpointOpt, collectorOpt),
+			hostOpt, endpointOpt, collectorOpt),
+	)
+
+	// the limiter wraps the instrumentation, so that the time spent waiting for a slot
+	// is not accounted as request duration.
 	return HTTPClient{
 		client: &http.Client{
-			Transport: promhttp.InstrumentRoundTripperInFlight(inFlightGauge,
-				promhttp.InstrumentRoundTripperCounter(counter,
-					promhttp.InstrumentRoundTripperDuration(histVec,
-						hostRoundTripper,
-						opts),
-					opts),
-			),
+			Transport: newLimiter(reg, settings.Limits).roundTripper(instrumentedRoundTripper),
 		},
 	}
 }
 
-func (c *HTTPClient) WithAzureCredential(cred azcore.TokenCredential) {
+// WithAzureCredential adds a bearer token to all requests sent to one of the Microsoft APIs of env.
+func (c *HTTPClient) WithAzureCredential(cred azcore.TokenCredential, env cloud.Environment) {
 	transport := c.client.Transport
 	c.client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
-		switch {
-		case req.Host == "management.azure.com", req.Host == "outlook.office365.com":
-			token, err := cred.GetToken(req.Context(), policy.TokenRequestOptions{
-				Scopes: []string{fmt.Sprintf("https://%s/.default", req.Host)},
-			})
-			if err != nil {
-				return nil, fmt.Errorf("getting token: %w", err)
-			}
+		var scope string
 
-			req.Header.Set("Authorization", "Bearer "+token.Token)
-		case req.Host == "graph.microsoft.com":
-			token, err := cred.GetToken(req.Context(), policy.TokenRequestOptions{
-				Scopes: []string{"https://graph.microsoft.com/.default"},
-			})
-			if err != nil {
-				return nil, fmt.Errorf("getting token: %w", err)
-			}
+		switch {
+		case req.Host == env.ARMHost(), req.Host == env.ExchangeHost(), req.Host == env.GraphHost(),
+			matchHost(env.SharePointAdminHostPattern(), req.Host):
+			scope = fmt.Sprintf("https://%s/.default", req.Host)
+		}
 
-			req.Header.Set("Authorization", "Bearer "+token.Token)
-		case strings.HasSuffix(req.Host, "-admin.sharepoint.com"):
+		if scope != "" {
 			token, err := cred.GetToken(req.Context(), policy.TokenRequestOptions{
-				Scopes: []string{fmt.Sprintf("https://%s/.default", req.Host)},
+				Scopes: []string{scope},
 			})
 			if err != nil {
 				return nil, fmt.Errorf("getting token: %w", err)
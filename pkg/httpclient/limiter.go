@@ -0,0 +1,257 @@
+package httpclient
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limits configures how many outbound requests may be executed at the same time.
+// A limit of zero or below disables the corresponding restriction.
+type Limits struct {
+	// Global is the maximum number of concurrent requests across all hosts.
+	Global int
+	// PerHost maps a host pattern to the maximum number of concurrent requests for matching hosts.
+	// A pattern may start with "*" to match every host with the given suffix, e.g. "*-admin.sharepoint.com".
+	// If several patterns match a host, an exact pattern wins over wildcards and a longer suffix over a shorter one.
+	PerHost map[string]int
+	// RequestsPerSecond is the refill rate of the token bucket shared by all requests.
+	RequestsPerSecond float64
+	// Burst is the size of the token bucket. Defaults to 1 if RequestsPerSecond is set.
+	Burst int
+}
+
+type hostLimit struct {
+	pattern string
+	sem     chan struct{}
+}
+
+type limiter struct {
+	global chan struct{}
+	hosts  []hostLimit
+	bucket *tokenBucket
+
+	queueWait *prometheus.HistogramVec
+	inFlight  *prometheus.GaugeVec
+}
+
+func newLimiter(reg prometheus.Registerer, limits Limits) *limiter {
+	lim := &limiter{
+		queueWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_client_queue_wait_seconds",
+				Help:    "Tracks the time HTTP requests wait for a free concurrency slot.",
+				Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60},
+			},
+			[]string{"host"},
+		),
+		inFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "http_client_host_requests_inflight",
+				Help: "Tracks the number of client requests currently in progress per host.",
+			},
+			[]string{"host"},
+		),
+	}
+
+	reg.MustRegister(lim.queueWait, lim.inFlight)
+
+	if limits.Global > 0 {
+		lim.global = make(chan struct{}, limits.Global)
+	}
+
+	for pattern, limit := range limits.PerHost {
+		if limit <= 0 {
+			continue
+		}
+
+		lim.hosts = append(lim.hosts, hostLimit{
+			pattern: pattern,
+			sem:     make(chan struct{}, limit),
+		})
+	}
+
+	slices.SortFunc(lim.hosts, func(a, b hostLimit) int {
+		return compareHostPatterns(a.pattern, b.pattern)
+	})
+
+	if limits.RequestsPerSecond > 0 {
+		lim.bucket = newTokenBucket(limits.RequestsPerSecond, limits.Burst)
+	}
+
+	return lim
+}
+
+// hostSemaphore returns the semaphore of the most specific host pattern that matches host.
+func (l *limiter) hostSemaphore(host string) chan struct{} {
+	for _, hostLimit := range l.hosts {
+		if matchHost(hostLimit.pattern, host) {
+			return hostLimit.sem
+		}
+	}
+
+	return nil
+}
+
+// acquire blocks until the request to host is allowed to be executed.
+// The returned function must be called once the request is finished.
+func (l *limiter) acquire(ctx context.Context, host string) (func(), error) {
+	start := time.Now()
+	hostSem := l.hostSemaphore(host)
+
+	// acquire the host slot first, so that requests waiting for a busy host do not block the global pool.
+	err := acquireSemaphore(ctx, hostSem)
+	if err != nil {
+		return nil, err
+	}
+
+	err = acquireSemaphore(ctx, l.global)
+	if err != nil {
+		releaseSemaphore(hostSem)
+
+		return nil, err
+	}
+
+	if l.bucket != nil {
+		err = l.bucket.wait(ctx)
+		if err != nil {
+			releaseSemaphore(l.global)
+			releaseSemaphore(hostSem)
+
+			return nil, err
+		}
+	}
+
+	l.queueWait.WithLabelValues(normalizeHost(host)).Observe(time.Since(start).Seconds())
+
+	inFlight := l.inFlight.WithLabelValues(normalizeHost(host))
+	inFlight.Inc()
+
+	return func() {
+		inFlight.Dec()
+		releaseSemaphore(l.global)
+		releaseSemaphore(hostSem)
+	}, nil
+}
+
+func (l *limiter) roundTripper(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		release, err := l.acquire(req.Context(), req.Host)
+		if err != nil {
+			return nil, fmt.Errorf("waiting for request slot: %w", err)
+		}
+
+		defer release()
+
+		return next.RoundTrip(req)
+	})
+}
+
+func acquireSemaphore(ctx context.Context, sem chan struct{}) error {
+	if sem == nil {
+		return nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func releaseSemaphore(sem chan struct{}) {
+	if sem == nil {
+		return
+	}
+
+	<-sem
+}
+
+// matchHost reports whether host matches pattern. A leading "*" in pattern matches any prefix.
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix)
+	}
+
+	return pattern == host
+}
+
+// compareHostPatterns orders exact patterns before wildcards and wildcards by descending suffix length.
+// Patterns of the same kind and length are ordered lexically, so the order never depends on map iteration.
+func compareHostPatterns(a, b string) int {
+	suffixA, wildcardA := strings.CutPrefix(a, "*")
+	suffixB, wildcardB := strings.CutPrefix(b, "*")
+
+	if wildcardA != wildcardB {
+		if wildcardA {
+			return 1
+		}
+
+		return -1
+	}
+
+	return cmp.Or(cmp.Compare(len(suffixB), len(suffixA)), strings.Compare(a, b))
+}
+
+// tokenBucket is a minimal token bucket rate limiter.
+type tokenBucket struct {
+	mu sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+
+		now := time.Now()
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+
+			return nil
+		}
+
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		}
+	}
+}
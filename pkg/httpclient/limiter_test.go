@@ -0,0 +1,130 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_matchHost(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, matchHost("graph.microsoft.com", "graph.microsoft.com"))
+	assert.False(t, matchHost("graph.microsoft.com", "management.azure.com"))
+	assert.True(t, matchHost("*-admin.sharepoint.com", "contoso-admin.sharepoint.com"))
+	assert.False(t, matchHost("*-admin.sharepoint.com", "contoso.sharepoint.com"))
+}
+
+func Test_LimiterHostPrecedence(t *testing.T) {
+	t.Parallel()
+
+	lim := newLimiter(prometheus.NewRegistry(), Limits{
+		PerHost: map[string]int{
+			"*.sharepoint.com":             1,
+			"*-admin.sharepoint.com":       2,
+			"contoso-admin.sharepoint.com": 3,
+			"*.com":                        4,
+		},
+	})
+
+	assert.Equal(t, 3, cap(lim.hostSemaphore("contoso-admin.sharepoint.com")))
+	assert.Equal(t, 2, cap(lim.hostSemaphore("fabrikam-admin.sharepoint.com")))
+	assert.Equal(t, 1, cap(lim.hostSemaphore("contoso.sharepoint.com")))
+	assert.Equal(t, 4, cap(lim.hostSemaphore("graph.microsoft.com")))
+	assert.Nil(t, lim.hostSemaphore("login.microsoftonline.us"))
+}
+
+func Test_LimiterBoundsConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var (
+		current atomic.Int32
+		peak    atomic.Int32
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := current.Add(1)
+		defer current.Add(-1)
+
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	httpClient := New(prometheus.NewRegistry(), Settings{
+		Limits: Limits{
+			Global:  10,
+			PerHost: map[string]int{"*" + server.Listener.Addr().String(): 2},
+		},
+	})
+	client := httpClient.GetHTTPClient()
+
+	var wg sync.WaitGroup
+
+	for range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+			assert.NoError(t, err)
+
+			resp, err := client.Do(req)
+			if assert.NoError(t, err) {
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+func Test_LimiterRespectsContext(t *testing.T) {
+	t.Parallel()
+
+	lim := newLimiter(prometheus.NewRegistry(), Limits{Global: 1})
+
+	release, err := lim.acquire(context.Background(), "graph.microsoft.com")
+	require.NoError(t, err)
+
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = lim.acquire(ctx, "graph.microsoft.com")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_TokenBucket(t *testing.T) {
+	t.Parallel()
+
+	bucket := newTokenBucket(50, 1)
+
+	start := time.Now()
+
+	for range 3 {
+		require.NoError(t, bucket.wait(context.Background()))
+	}
+
+	// the first token is available immediately, the following two are refilled at 50/s
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+}
@@ -0,0 +1,394 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Interface guard.
+var (
+	_ http.RoundTripper = (*recordingTransport)(nil)
+	_ http.RoundTripper = (*replayTransport)(nil)
+)
+
+var fileNamePattern = regexp.MustCompile(`[^A-Za-z0-9.]+`)
+
+// Recording is a sanitized request and its response, as written by the recording transport.
+type Recording struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// BodySHA256 is the hash of the sanitized request body, it distinguishes e.g. $batch requests. The random step ids
+	// of $batch requests are replaced with their index before hashing.
+	BodySHA256 string `json:"bodySHA256,omitempty"`
+
+	// batchIDs are the original step ids of a $batch request, by index.
+	batchIDs []string
+}
+
+type RecordedResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	// Body is set for JSON responses, Text for all others.
+	Body json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+func (r RecordedRequest) key() string {
+	return r.Method + " " + r.URL + " " + r.BodySHA256
+}
+
+// recordedHeaders are the response headers kept in recordings, others may contain request ids or cookies.
+var recordedHeaders = []string{"Content-Type", "Retry-After"}
+
+type recordingTransport struct {
+	next      http.RoundTripper
+	dir       string
+	sanitizer *Sanitizer
+
+	mu sync.Mutex
+}
+
+// NewRecordingTransport returns a transport which sends requests with next and writes each sanitized request and
+// response to a JSON file in dir. A request sent again overwrites its recording. Token requests are not recorded.
+func NewRecordingTransport(next http.RoundTripper, dir string, sanitizer *Sanitizer) (http.RoundTripper, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("error creating recording directory: %w", err)
+	}
+
+	return &recordingTransport{next: next, dir: dir, sanitizer: sanitizer}, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := recordRequest(req, t.sanitizer)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// tokens are useless offline, the replay mode doesn't authenticate
+	if strings.Contains(req.URL.Path, "/oauth2/") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	recording := Recording{
+		Request:  request,
+		Response: RecordedResponse{Status: resp.StatusCode, Header: map[string]string{}},
+	}
+
+	for _, key := range recordedHeaders {
+		if value := resp.Header.Get(key); value != "" {
+			recording.Response.Header[key] = value
+		}
+	}
+
+	if json.Valid(body) {
+		// the recording refers to the steps by index, the next run sends other step ids
+		if request.batchIDs != nil {
+			indexes := make(map[string]string, len(request.batchIDs))
+			for i, id := range request.batchIDs {
+				indexes[id] = strconv.Itoa(i)
+			}
+
+			body = renameBatchResponses(body, func(id string) string { return indexes[id] })
+		}
+
+		recording.Response.Body = t.sanitizer.JSON(body)
+	} else {
+		recording.Response.Text = t.sanitizer.Text(string(body))
+	}
+
+	err = t.write(recording)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (t *recordingTransport) write(recording Recording) error {
+	var content bytes.Buffer
+
+	// keep & of next links readable
+	encoder := json.NewEncoder(&content)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(recording)
+	if err != nil {
+		return fmt.Errorf("error encoding recording: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err = os.WriteFile(filepath.Join(t.dir, recording.Request.fileName()), content.Bytes(), 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing recording: %w", err)
+	}
+
+	return nil
+}
+
+// fileName returns a readable and unique file name, e.g. get-graph.microsoft.com_v1.0_users-1a2b3c4d5e6f.json.
+func (r RecordedRequest) fileName() string {
+	sum := sha256.Sum256([]byte(r.key()))
+
+	name := r.URL
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+
+	name, _, _ = strings.Cut(name, "?")
+	name = strings.Trim(fileNamePattern.ReplaceAllString(name, "_"), "_")
+
+	if len(name) > 80 {
+		name = name[:80]
+	}
+
+	return strings.ToLower(r.Method) + "-" + name + "-" + hex.EncodeToString(sum[:6]) + ".json"
+}
+
+// recordRequest returns the sanitized request. The request body is read and replaced.
+func recordRequest(req *http.Request, sanitizer *Sanitizer) (RecordedRequest, error) {
+	request := RecordedRequest{
+		Method: req.Method,
+		URL:    sanitizer.URL(req.URL).String(),
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return request, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+
+	if err != nil {
+		return request, fmt.Errorf("error reading request body: %w", err)
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if strings.HasSuffix(req.URL.Path, "/$batch") {
+		body, request.batchIDs = normalizeBatch(body)
+	}
+
+	if len(body) > 0 {
+		sum := sha256.Sum256([]byte(sanitizer.Text(string(body))))
+		request.BodySHA256 = hex.EncodeToString(sum[:])
+	}
+
+	return request, nil
+}
+
+// normalizeBatch replaces the step ids of a $batch request body, and the references to them in dependsOn, with the
+// index of the step. It returns the body and the original step ids, or the unchanged body if it isn't a batch.
+func normalizeBatch(body []byte) ([]byte, []string) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil {
+		return body, nil
+	}
+
+	steps, ok := document["requests"].([]any)
+	if !ok {
+		return body, nil
+	}
+
+	ids := make([]string, len(steps))
+	indexes := make(map[string]string, len(steps))
+
+	for i, step := range steps {
+		if step, ok := step.(map[string]any); ok {
+			ids[i], _ = step["id"].(string)
+			indexes[ids[i]] = strconv.Itoa(i)
+			step["id"] = strconv.Itoa(i)
+		}
+	}
+
+	for _, step := range steps {
+		step, _ := step.(map[string]any)
+
+		dependsOn, ok := step["dependsOn"].([]any)
+		if !ok {
+			continue
+		}
+
+		for i, id := range dependsOn {
+			if id, ok := id.(string); ok {
+				dependsOn[i] = indexes[id]
+			}
+		}
+	}
+
+	normalized, err := json.Marshal(document)
+	if err != nil {
+		return body, nil
+	}
+
+	return normalized, ids
+}
+
+// renameBatchResponses replaces the ids of the responses in a $batch response body with rename.
+func renameBatchResponses(body []byte, rename func(id string) string) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil {
+		return body
+	}
+
+	responses, ok := document["responses"].([]any)
+	if !ok {
+		return body
+	}
+
+	for _, response := range responses {
+		if response, ok := response.(map[string]any); ok {
+			if id, ok := response["id"].(string); ok {
+				response["id"] = rename(id)
+			}
+		}
+	}
+
+	renamed, err := json.Marshal(document)
+	if err != nil {
+		return body
+	}
+
+	return renamed
+}
+
+type replayTransport struct {
+	sanitizer  *Sanitizer
+	recordings map[string]RecordedResponse
+}
+
+// NewReplayTransport returns a transport which answers requests with the recordings in dir, without sending them.
+// Requests are sanitized like during recording to find their recording, so the sanitizer needs the same salt.
+// Requests without a recording are answered with 404.
+func NewReplayTransport(dir string, sanitizer *Sanitizer) (http.RoundTripper, error) {
+	t := &replayTransport{sanitizer: sanitizer, recordings: map[string]RecordedResponse{}}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading recording: %w", err)
+		}
+
+		var recording Recording
+
+		err = json.Unmarshal(content, &recording)
+		if err != nil {
+			return fmt.Errorf("error decoding recording %s: %w", path, err)
+		}
+
+		t.recordings[recording.Request.key()] = recording.Response
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading recordings from %s: %w", dir, err)
+	}
+
+	if len(t.recordings) == 0 {
+		return nil, errors.New("no recordings found in " + dir)
+	}
+
+	return t, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := recordRequest(req, t.sanitizer)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, ok := t.recordings[request.key()]
+	if !ok {
+		body, err := json.Marshal(map[string]any{
+			"error": map[string]string{"code": "NoRecording", "message": "no recording for " + request.Method + " " + request.URL},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding response: %w", err)
+		}
+
+		recorded = RecordedResponse{
+			Status: http.StatusNotFound,
+			Header: map[string]string{"Content-Type": "application/json"},
+			Body:   body,
+		}
+	}
+
+	body := []byte(recorded.Text)
+	if recorded.Body != nil {
+		body = recorded.Body
+	}
+
+	// map the step indexes of the recording to the step ids of this request
+	if request.batchIDs != nil && recorded.Body != nil {
+		body = renameBatchResponses(body, func(index string) string {
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 || i >= len(request.batchIDs) {
+				return index
+			}
+
+			return request.batchIDs[i]
+		})
+	}
+
+	header := http.Header{}
+	for key, value := range recorded.Header {
+		header.Set(key, value)
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.Status) + " " + http.StatusText(recorded.Status),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
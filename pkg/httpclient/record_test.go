@@ -0,0 +1,197 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/pkg/graphbatch"
+	"github.com/microsoft/kiota-abstractions-go/authentication"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Request-Id", "6f6a2b9e-0000-4000-8000-000000000001")
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1.0/$batch":
+			body, _ := io.ReadAll(r.Body)
+			_, _ = w.Write([]byte(`{"responses":[{"id":"1","status":200,"body":` + string(body) + `}]}`))
+		case r.URL.Path == "/v1.0/users/alice@contoso.com/drive":
+			_, _ = w.Write([]byte(`{"id":"b!drive","driveType":"business","owner":{"user":{"displayName":"Alice Smith"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	sanitizer := NewSanitizer("salt")
+
+	recorder, err := NewRecordingTransport(http.DefaultTransport, dir, sanitizer)
+	require.NoError(t, err)
+
+	recorded := roundTrip(t, recorder, http.MethodGet, server.URL+"/v1.0/users/alice@contoso.com/drive", "")
+	assert.Contains(t, recorded, "Alice Smith", "the recorded response is passed on unchanged")
+
+	roundTrip(t, recorder, http.MethodPost, server.URL+"/v1.0/$batch", `{"url":"/users/0f8fad5b-d9cb-469f-a165-70867728950e"}`)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	for _, file := range files {
+		content, err := os.ReadFile(dir + "/" + file.Name())
+		require.NoError(t, err)
+
+		assert.NotContains(t, string(content), "alice")
+		assert.NotContains(t, string(content), "Alice")
+		assert.NotContains(t, string(content), "0f8fad5b")
+		assert.NotContains(t, string(content), "Request-Id")
+	}
+
+	replay, err := NewReplayTransport(dir, sanitizer)
+	require.NoError(t, err)
+
+	// requests are matched after sanitizing, with the original or the pseudonymized values
+	replayed := roundTrip(t, replay, http.MethodGet, server.URL+"/v1.0/users/alice@contoso.com/drive", "")
+	assert.Contains(t, replayed, `"business"`)
+	assert.NotContains(t, replayed, "Alice")
+
+	pseudonym := sanitizer.Text("alice@contoso.com")
+	assert.Equal(t, replayed, roundTrip(t, replay, http.MethodGet, server.URL+"/v1.0/users/"+pseudonym+"/drive", ""))
+
+	replayedBatch := roundTrip(t, replay, http.MethodPost, server.URL+"/v1.0/$batch", `{"url":"/users/0f8fad5b-d9cb-469f-a165-70867728950e"}`)
+	assert.Contains(t, replayedBatch, sanitizer.Text("0f8fad5b-d9cb-469f-a165-70867728950e"))
+
+	missing := roundTrip(t, replay, http.MethodGet, server.URL+"/v1.0/users", "")
+	assert.Contains(t, missing, "NoRecording")
+}
+
+func TestRecordAndReplay_Batch(t *testing.T) {
+	t.Parallel()
+
+	// answers in reverse order, with the drive type of a user's drive
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch struct {
+			Requests []struct {
+				ID  string `json:"id"`
+				URL string `json:"url"`
+			} `json:"requests"`
+		}
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+
+		responses := make([]map[string]any, 0, len(batch.Requests))
+
+		for _, step := range slices.Backward(batch.Requests) {
+			driveType := "business"
+			if strings.Contains(step.URL, "/users/bob/") {
+				driveType = "personal"
+			}
+
+			responses = append(responses, map[string]any{
+				"id": step.ID, "status": http.StatusOK, "headers": map[string]string{"Content-Type": "application/json"},
+				"body": map[string]any{"driveType": driveType},
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{"responses": responses}))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	sanitizer := NewSanitizer("salt")
+
+	recorder, err := NewRecordingTransport(http.DefaultTransport, dir, sanitizer)
+	require.NoError(t, err)
+
+	// the SDK gives the steps new random ids on every run
+	assert.Equal(t, []string{"business", "personal"}, getDriveTypes(t, recorder, server.URL))
+	assert.Equal(t, []string{"business", "personal"}, getDriveTypes(t, recorder, server.URL))
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1, "both batches have the same recording")
+
+	replay, err := NewReplayTransport(dir, sanitizer)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"business", "personal"}, getDriveTypes(t, replay, server.URL))
+}
+
+// getDriveTypes gets the drives of alice and bob in a $batch request of the SDK.
+func getDriveTypes(t *testing.T, transport http.RoundTripper, baseURL string) []string {
+	t.Helper()
+
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(
+		&authentication.AnonymousAuthenticationProvider{}, nil, nil, &http.Client{Transport: transport},
+	)
+	require.NoError(t, err)
+
+	adapter.SetBaseUrl(baseURL + "/v1.0")
+
+	client := msgraphsdk.NewGraphServiceClient(adapter)
+
+	requests := make([]graphbatch.Request, 0, 2)
+
+	for _, userID := range []string{"alice", "bob"} {
+		// TODO: Go 1.24: Change to t.Context()
+		requestInfo, err := client.Users().ByUserId(userID).Drive().ToGetRequestInformation(context.Background(), nil)
+		require.NoError(t, err)
+
+		requests = append(requests, graphbatch.Request{Key: userID, Info: requestInfo})
+	}
+
+	// TODO: Go 1.24: Change to t.Context()
+	results, err := graphbatch.Execute[models.Driveable](context.Background(), adapter, requests, models.CreateDriveFromDiscriminatorValue, graphbatch.Settings{})
+	require.NoError(t, err)
+
+	driveTypes := make([]string, 0, len(results))
+
+	for _, result := range results {
+		require.NoError(t, result.Err)
+
+		driveTypes = append(driveTypes, *result.Value.GetDriveType())
+	}
+
+	return driveTypes
+}
+
+func TestNewReplayTransport_Empty(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewReplayTransport(t.TempDir(), NewSanitizer(""))
+	require.Error(t, err)
+}
+
+func roundTrip(t *testing.T, transport http.RoundTripper, method, url, body string) string {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), method, url, strings.NewReader(body))
+	require.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return string(content)
+}
@@ -0,0 +1,171 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// pseudonymGUIDPrefix marks GUIDs created by the Sanitizer, so sanitizing them again keeps them.
+	pseudonymGUIDPrefix = "00000000-"
+	// pseudonymDomain is the domain of UPNs and mail addresses created by the Sanitizer.
+	pseudonymDomain = "@example.com"
+	// pseudonymTenantPrefix starts the tenant names created by the Sanitizer, tenant names can't contain hyphens.
+	pseudonymTenantPrefix = "tenant"
+	redacted              = "REDACTED"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+'#-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+`)
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// tenantPatterns match the tenant name in its initial domain and its SharePoint hosts, e.g.
+	// contoso.mail.onmicrosoft.com or contoso-admin.sharepoint.com. The first group is the tenant name.
+	tenantPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b([a-z0-9]+)(\.(?:mail\.)?onmicrosoft\.(?:com|us|de))\b`),
+		regexp.MustCompile(`(?i)\b([a-z0-9]+)((?:-admin|-my)?\.sharepoint\.(?:com|us|de|cn))\b`),
+	}
+	pseudonymTenantPattern = regexp.MustCompile(`^` + pseudonymTenantPrefix + `[0-9a-f]{8}$`)
+)
+
+// nameKeys are JSON keys whose values are names of people, groups, apps or organizations.
+var nameKeys = map[string]bool{
+	"displayName":              true,
+	"givenName":                true,
+	"surname":                  true,
+	"mailNickname":             true,
+	"jobTitle":                 true,
+	"department":               true,
+	"companyName":              true,
+	"organizationName":         true,
+	"tokenName":                true,
+	"onPremisesSamAccountName": true,
+}
+
+// Sanitizer replaces tokens, UPNs, mail addresses, GUIDs and display names of recorded requests and responses.
+// Pseudonyms are derived from a salted hash, so a value gets the same pseudonym in every recording, and
+// sanitizing a pseudonym returns it unchanged.
+type Sanitizer struct {
+	salt string
+}
+
+// NewSanitizer returns a sanitizer whose pseudonyms depend on salt. Without a salt, pseudonyms of guessable
+// values such as UPNs can be reversed by hashing candidates.
+func NewSanitizer(salt string) *Sanitizer {
+	return &Sanitizer{salt: salt}
+}
+
+// Text replaces tokens, UPNs, mail addresses, tenant names and GUIDs in text.
+func (s *Sanitizer) Text(text string) string {
+	text = jwtPattern.ReplaceAllString(text, redacted)
+
+	text = emailPattern.ReplaceAllStringFunc(text, func(email string) string {
+		if strings.HasSuffix(strings.ToLower(email), pseudonymDomain) {
+			return email
+		}
+
+		return "user-" + s.hash("email", strings.ToLower(email))[:8] + pseudonymDomain
+	})
+
+	for _, pattern := range tenantPatterns {
+		text = pattern.ReplaceAllStringFunc(text, func(domain string) string {
+			match := pattern.FindStringSubmatch(domain)
+			if pseudonymTenantPattern.MatchString(match[1]) {
+				return domain
+			}
+
+			return pseudonymTenantPrefix + s.hash("tenant", strings.ToLower(match[1]))[:8] + match[2]
+		})
+	}
+
+	return guidPattern.ReplaceAllStringFunc(text, func(guid string) string {
+		if strings.HasPrefix(guid, pseudonymGUIDPrefix) {
+			return guid
+		}
+
+		h := s.hash("guid", strings.ToLower(guid))
+
+		return pseudonymGUIDPrefix + h[0:4] + "-" + h[4:8] + "-" + h[8:12] + "-" + h[12:24]
+	})
+}
+
+// URL returns a copy of u with a sanitized host, path and query. The query parameters are sorted.
+func (s *Sanitizer) URL(u *url.URL) *url.URL {
+	sanitized := *u
+	sanitized.User = nil
+	sanitized.Host = s.Text(u.Host)
+	sanitized.Path = s.Text(u.Path)
+	sanitized.RawPath = ""
+
+	query := u.Query()
+	for key, values := range query {
+		for i, value := range values {
+			values[i] = s.Text(value)
+		}
+
+		query[key] = values
+	}
+
+	sanitized.RawQuery = query.Encode()
+
+	return &sanitized
+}
+
+// JSON sanitizes all strings of a JSON document and replaces the values of name keys, e.g. displayName,
+// with pseudonyms. Invalid JSON is sanitized as text.
+func (s *Sanitizer) JSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document any
+
+	if err := decoder.Decode(&document); err != nil {
+		return []byte(s.Text(string(body)))
+	}
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(s.value("", document)); err != nil {
+		return []byte(s.Text(string(body)))
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func (s *Sanitizer) value(key string, value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		for k, v := range typed {
+			typed[k] = s.value(k, v)
+		}
+
+		return typed
+	case []any:
+		for i, v := range typed {
+			typed[i] = s.value(key, v)
+		}
+
+		return typed
+	case string:
+		if nameKeys[key] && typed != "" {
+			return "name-" + s.hash("name", typed)[:8]
+		}
+
+		return s.Text(typed)
+	default:
+		return value
+	}
+}
+
+func (s *Sanitizer) hash(kind, value string) string {
+	sum := sha256.Sum256([]byte(s.salt + "\x00" + kind + "\x00" + value))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,100 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTransport_Proxy(t *testing.T) {
+	t.Parallel()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("s3cr3t\n"), 0o600))
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxied request contains the absolute url and the credentials of the proxy url
+		assert.Equal(t, "http://graph.example.com/v1.0/users", r.RequestURI)
+		assert.Equal(t, "Basic dXNlcjpzM2NyM3Q=", r.Header.Get("Proxy-Authorization"))
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	transport, err := NewTransport(TransportSettings{
+		ProxyURL:          "http://user:ignored@" + proxy.Listener.Addr().String(),
+		ProxyPasswordFile: passwordFile,
+		NoProxy:           "internal.example.com",
+	})
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: transport}).Get("http://graph.example.com/v1.0/users")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, "https://internal.example.com/", nil)
+	require.NoError(t, err)
+
+	proxyURL, err := transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL)
+}
+
+func TestNewTransport_NoProxyEnvironment(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "internal.example.com")
+
+	transport, err := NewTransport(TransportSettings{ProxyURL: "http://proxy.example.com:3128"})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "https://internal.example.com/", nil)
+	require.NoError(t, err)
+
+	proxyURL, err := transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL)
+
+	req, err = http.NewRequest(http.MethodGet, "https://graph.example.com/", nil)
+	require.NoError(t, err)
+
+	proxyURL, err = transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, "proxy.example.com:3128", proxyURL.Host)
+}
+
+func TestNewTransport_CAFile(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0o600))
+
+	transport, err := NewTransport(TransportSettings{CAFile: caFile, TLSHandshakeTimeout: 5 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	require.NoError(t, os.WriteFile(caFile, []byte("no certificate"), 0o600))
+
+	_, err = NewTransport(TransportSettings{CAFile: caFile})
+	require.ErrorContains(t, err, "no certificates found")
+}
@@ -0,0 +1,540 @@
+// Package inventory keeps an in-memory copy of directory objects (users, groups and devices),
+// which is kept up to date using Microsoft Graph delta queries.
+//
+// https://learn.microsoft.com/en-us/graph/delta-query-overview
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudeteer/m365-exporter/pkg/collectors/abstract"
+	"github.com/cloudeteer/m365-exporter/pkg/util"
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	"github.com/microsoft/kiota-abstractions-go/serialization"
+	"github.com/microsoft/kiota-abstractions-go/store"
+	jsonserialization "github.com/microsoft/kiota-serialization-json-go"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/devices"
+	"github.com/microsoftgraph/msgraph-sdk-go/groups"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
+	"github.com/microsoftgraph/msgraph-sdk-go/users"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const subsystem = "inventory"
+
+// Settings configures the Cache.
+type Settings struct {
+	// MinSyncInterval is the minimum time between two delta syncs of the same object type.
+	// Reads within this interval are served from memory without contacting Graph.
+	MinSyncInterval time.Duration
+	// FullSyncInterval forces a full resync after the given time, even if the delta token is still valid.
+	// Zero disables periodic full resyncs.
+	FullSyncInterval time.Duration
+}
+
+// Cache holds users, groups and devices of a tenant. Each object type is synchronized lazily on first access
+// and incrementally afterward. If a delta token expires, the object type is fully resynchronized.
+type Cache struct {
+	logger   *slog.Logger
+	settings Settings
+
+	users   *deltaSet[models.Userable]
+	groups  *deltaSet[models.Groupable]
+	devices *deltaSet[models.Deviceable]
+
+	objectsDesc      *prometheus.Desc
+	lastSyncDesc     *prometheus.Desc
+	lastFullSyncDesc *prometheus.Desc
+	fullSyncs        *prometheus.CounterVec
+}
+
+// Interface guard.
+var _ prometheus.Collector = (*Cache)(nil)
+
+// deltaPage is a single page of a delta query response.
+type deltaPage[T models.DirectoryObjectable] struct {
+	values []T
+	// properties are the properties in the payload of each value, in the order of values.
+	properties []map[string]struct{}
+	nextLink   *string
+	deltaLink  *string
+}
+
+// deltaResponse is the response of a delta function of the SDK, e.g. users.DeltaGetResponseable.
+type deltaResponse[T models.DirectoryObjectable] interface {
+	serialization.Parsable
+	GetValue() []T
+	GetOdataNextLink() *string
+	GetOdataDeltaLink() *string
+}
+
+// deltaResult holds all pages of a delta query.
+type deltaResult[T models.DirectoryObjectable] struct {
+	changed map[string]T
+	// properties are the properties in the payload of each changed object, see fillMissing.
+	properties map[string]map[string]struct{}
+	removed    []string
+	deltaLink  string
+}
+
+type deltaSet[T models.DirectoryObjectable] struct {
+	// syncMu serializes syncs, mu guards the fields below against concurrent reads during a sync.
+	syncMu sync.Mutex
+	mu     sync.RWMutex
+
+	name  string
+	fetch func(ctx context.Context, link string) (deltaPage[T], error)
+
+	items     map[string]T
+	deltaLink string
+
+	lastSync     time.Time
+	lastFullSync time.Time
+}
+
+func NewCache(logger *slog.Logger, tenant string, msGraphClient *msgraphsdk.GraphServiceClient, settings Settings) *Cache {
+	cache := &Cache{
+		logger:   logger.With(slog.String("component", subsystem)),
+		settings: settings,
+
+		objectsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "objects"),
+			"number of directory objects held in the inventory cache",
+			[]string{"type"},
+			prometheus.Labels{"tenant": tenant},
+		),
+		lastSyncDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "last_sync_seconds_timestamp"),
+			"timestamp of the last delta sync of the inventory cache",
+			[]string{"type"},
+			prometheus.Labels{"tenant": tenant},
+		),
+		lastFullSyncDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(abstract.Namespace, subsystem, "last_full_sync_seconds_timestamp"),
+			"timestamp of the last full sync of the inventory cache",
+			[]string{"type"},
+			prometheus.Labels{"tenant": tenant},
+		),
+		fullSyncs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   abstract.Namespace,
+				Subsystem:   subsystem,
+				Name:        "full_syncs_total",
+				Help:        "number of full syncs of the inventory cache, labeled by reason",
+				ConstLabels: prometheus.Labels{"tenant": tenant},
+			},
+			[]string{"type", "reason"},
+		),
+	}
+
+	cache.users = &deltaSet[models.Userable]{
+		name: "users",
+		fetch: func(ctx context.Context, link string) (deltaPage[models.Userable], error) {
+			builder := msGraphClient.Users().Delta()
+			config := &users.DeltaRequestBuilderGetRequestConfiguration{
+				QueryParameters: &users.DeltaRequestBuilderGetQueryParameters{
+					Select: []string{"id", "userPrincipalName", "displayName", "accountEnabled", "userType"},
+				},
+			}
+
+			if link != "" {
+				builder = builder.WithUrl(link)
+				config = nil
+			}
+
+			request, err := builder.ToGetRequestInformation(ctx, config)
+			if err != nil {
+				return deltaPage[models.Userable]{}, err
+			}
+
+			return getDeltaPage[models.Userable, users.DeltaGetResponseable](ctx, msGraphClient.GetAdapter(), request, users.CreateDeltaGetResponseFromDiscriminatorValue)
+		},
+	}
+
+	cache.groups = &deltaSet[models.Groupable]{
+		name: "groups",
+		fetch: func(ctx context.Context, link string) (deltaPage[models.Groupable], error) {
+			builder := msGraphClient.Groups().Delta()
+			config := &groups.DeltaRequestBuilderGetRequestConfiguration{
+				QueryParameters: &groups.DeltaRequestBuilderGetQueryParameters{
+					Select: []string{"id", "displayName", "groupTypes", "mailEnabled", "securityEnabled"},
+				},
+			}
+
+			if link != "" {
+				builder = builder.WithUrl(link)
+				config = nil
+			}
+
+			request, err := builder.ToGetRequestInformation(ctx, config)
+			if err != nil {
+				return deltaPage[models.Groupable]{}, err
+			}
+
+			return getDeltaPage[models.Groupable, groups.DeltaGetResponseable](ctx, msGraphClient.GetAdapter(), request, groups.CreateDeltaGetResponseFromDiscriminatorValue)
+		},
+	}
+
+	cache.devices = &deltaSet[models.Deviceable]{
+		name: "devices",
+		fetch: func(ctx context.Context, link string) (deltaPage[models.Deviceable], error) {
+			builder := msGraphClient.Devices().Delta()
+			config := &devices.DeltaRequestBuilderGetRequestConfiguration{
+				QueryParameters: &devices.DeltaRequestBuilderGetQueryParameters{
+					Select: []string{"id", "displayName", "operatingSystem", "operatingSystemVersion", "accountEnabled"},
+				},
+			}
+
+			if link != "" {
+				builder = builder.WithUrl(link)
+				config = nil
+			}
+
+			request, err := builder.ToGetRequestInformation(ctx, config)
+			if err != nil {
+				return deltaPage[models.Deviceable]{}, err
+			}
+
+			return getDeltaPage[models.Deviceable, devices.DeltaGetResponseable](ctx, msGraphClient.GetAdapter(), request, devices.CreateDeltaGetResponseFromDiscriminatorValue)
+		},
+	}
+
+	for _, name := range []string{cache.users.name, cache.groups.name, cache.devices.name} {
+		cache.fullSyncs.WithLabelValues(name, "initial")
+		cache.fullSyncs.WithLabelValues(name, "token_expired")
+		cache.fullSyncs.WithLabelValues(name, "scheduled")
+	}
+
+	return cache
+}
+
+// Users returns all users of the tenant, synchronizing the cache first if needed.
+func (c *Cache) Users(ctx context.Context) ([]models.Userable, error) {
+	return get(ctx, c, c.users)
+}
+
+// Groups returns all groups of the tenant, synchronizing the cache first if needed.
+func (c *Cache) Groups(ctx context.Context) ([]models.Groupable, error) {
+	return get(ctx, c, c.groups)
+}
+
+// Devices returns all devices registered in Entra ID, synchronizing the cache first if needed.
+func (c *Cache) Devices(ctx context.Context) ([]models.Deviceable, error) {
+	return get(ctx, c, c.devices)
+}
+
+func (c *Cache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.objectsDesc
+
+	ch <- c.lastSyncDesc
+
+	ch <- c.lastFullSyncDesc
+
+	c.fullSyncs.Describe(ch)
+}
+
+func (c *Cache) Collect(ch chan<- prometheus.Metric) {
+	collect(ch, c, c.users)
+	collect(ch, c, c.groups)
+	collect(ch, c, c.devices)
+
+	c.fullSyncs.Collect(ch)
+}
+
+func collect[T models.DirectoryObjectable](ch chan<- prometheus.Metric, c *Cache, set *deltaSet[T]) {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+
+	// do not expose object types which are not used by any collector
+	if set.lastSync.IsZero() {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.objectsDesc, prometheus.GaugeValue, float64(len(set.items)), set.name)
+
+	ch <- prometheus.MustNewConstMetric(c.lastSyncDesc, prometheus.GaugeValue, float64(set.lastSync.Unix()), set.name)
+
+	ch <- prometheus.MustNewConstMetric(c.lastFullSyncDesc, prometheus.GaugeValue, float64(set.lastFullSync.Unix()), set.name)
+}
+
+func get[T models.DirectoryObjectable](ctx context.Context, c *Cache, set *deltaSet[T]) ([]T, error) {
+	set.syncMu.Lock()
+	defer set.syncMu.Unlock()
+
+	if set.lastSync.IsZero() || time.Since(set.lastSync) >= c.settings.MinSyncInterval {
+		err := syncDelta(ctx, c, set)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sync %s: %w", set.name, err)
+		}
+	}
+
+	set.mu.RLock()
+
+	items := make([]T, 0, len(set.items))
+	for _, item := range set.items {
+		items = append(items, item)
+	}
+
+	set.mu.RUnlock()
+
+	slices.SortFunc(items, func(a, b T) int {
+		return compareIDs(a.GetId(), b.GetId())
+	})
+
+	return items, nil
+}
+
+// syncDelta brings set up to date. It must be called with set.syncMu held.
+func syncDelta[T models.DirectoryObjectable](ctx context.Context, c *Cache, set *deltaSet[T]) error {
+	reason := ""
+
+	switch {
+	case set.deltaLink == "":
+		reason = "initial"
+	case c.settings.FullSyncInterval > 0 && time.Since(set.lastFullSync) >= c.settings.FullSyncInterval:
+		reason = "scheduled"
+	}
+
+	if reason != "" {
+		return fullSync(ctx, c, set, reason)
+	}
+
+	result, err := fetchAll(ctx, set, set.deltaLink)
+	if err != nil {
+		if isDeltaTokenExpired(err) {
+			c.logger.InfoContext(ctx, "delta token expired, starting full resync",
+				slog.String("type", set.name),
+				slog.Any("err", util.GetOdataError(err)),
+			)
+
+			return fullSync(ctx, c, set, "token_expired")
+		}
+
+		return err
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	for id, item := range result.changed {
+		// delta responses of updated objects might only contain the changed properties.
+		// Objects already handed out to collectors are never modified, the new object is completed instead.
+		if existing, ok := set.items[id]; ok {
+			fillMissing(item, existing, result.properties[id])
+		}
+
+		set.items[id] = item
+	}
+
+	for _, id := range result.removed {
+		delete(set.items, id)
+	}
+
+	set.deltaLink = result.deltaLink
+	set.lastSync = time.Now()
+
+	c.logger.DebugContext(ctx, "delta sync finished",
+		slog.String("type", set.name),
+		slog.Int("changed", len(result.changed)),
+		slog.Int("removed", len(result.removed)),
+	)
+
+	return nil
+}
+
+func fullSync[T models.DirectoryObjectable](ctx context.Context, c *Cache, set *deltaSet[T], reason string) error {
+	result, err := fetchAll(ctx, set, "")
+	if err != nil {
+		return err
+	}
+
+	c.fullSyncs.WithLabelValues(set.name, reason).Inc()
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	set.items = result.changed
+	set.deltaLink = result.deltaLink
+	set.lastSync = time.Now()
+	set.lastFullSync = set.lastSync
+
+	c.logger.InfoContext(ctx, "full sync finished",
+		slog.String("type", set.name),
+		slog.String("reason", reason),
+		slog.Int("objects", len(result.changed)),
+	)
+
+	return nil
+}
+
+// fetchAll follows all pages of a delta query, starting at link, and returns the changed and removed objects
+// as well as the delta link for the next sync.
+func fetchAll[T models.DirectoryObjectable](ctx context.Context, set *deltaSet[T], link string) (deltaResult[T], error) {
+	result := deltaResult[T]{
+		changed:    make(map[string]T),
+		properties: make(map[string]map[string]struct{}),
+		removed:    make([]string, 0),
+	}
+
+	for {
+		page, err := set.fetch(ctx, link)
+		if err != nil {
+			return deltaResult[T]{}, err
+		}
+
+		for i, item := range page.values {
+			if item.GetId() == nil {
+				continue
+			}
+
+			id := *item.GetId()
+
+			if _, ok := item.GetAdditionalData()["@removed"]; ok {
+				delete(result.changed, id)
+				delete(result.properties, id)
+				result.removed = append(result.removed, id)
+
+				continue
+			}
+
+			result.changed[id] = item
+			result.properties[id] = page.properties[i]
+		}
+
+		switch {
+		case page.nextLink != nil && *page.nextLink != "":
+			link = *page.nextLink
+		case page.deltaLink != nil && *page.deltaLink != "":
+			result.deltaLink = *page.deltaLink
+
+			return result, nil
+		default:
+			return deltaResult[T]{}, errors.New("delta response contains neither a next link nor a delta link")
+		}
+	}
+}
+
+// getDeltaPage sends request and parses the response into a page of R. Besides the values, the page contains the
+// properties in the payload of each value: the models of the SDK skip null values, so a property cleared to null
+// can't be told apart from a property which was not returned.
+func getDeltaPage[T models.DirectoryObjectable, R deltaResponse[T]](
+	ctx context.Context, adapter abstractions.RequestAdapter, request *abstractions.RequestInformation, factory serialization.ParsableFactory,
+) (deltaPage[T], error) {
+	errorMapping := abstractions.ErrorMappings{
+		"XXX": odataerrors.CreateODataErrorFromDiscriminatorValue,
+	}
+
+	content, err := adapter.SendPrimitive(ctx, request, "[]byte", errorMapping)
+	if err != nil {
+		return deltaPage[T]{}, err
+	}
+
+	body, ok := content.([]byte)
+	if !ok || len(body) == 0 {
+		return deltaPage[T]{}, errors.New("delta response has no body")
+	}
+
+	parseNode, err := jsonserialization.NewJsonParseNode(body)
+	if err != nil {
+		return deltaPage[T]{}, fmt.Errorf("error parsing delta response: %w", err)
+	}
+
+	parsable, err := parseNode.GetObjectValue(factory)
+	if err != nil {
+		return deltaPage[T]{}, fmt.Errorf("error parsing delta response: %w", err)
+	}
+
+	resp, ok := parsable.(R)
+	if !ok {
+		return deltaPage[T]{}, fmt.Errorf("unexpected delta response %T", parsable)
+	}
+
+	var raw struct {
+		Value []map[string]json.RawMessage `json:"value"`
+	}
+
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return deltaPage[T]{}, fmt.Errorf("error parsing delta response: %w", err)
+	}
+
+	if len(raw.Value) != len(resp.GetValue()) {
+		return deltaPage[T]{}, fmt.Errorf("delta response contains %d objects, but %d were parsed", len(raw.Value), len(resp.GetValue()))
+	}
+
+	properties := make([]map[string]struct{}, len(raw.Value))
+
+	for i, object := range raw.Value {
+		properties[i] = make(map[string]struct{}, len(object))
+
+		for property := range object {
+			properties[i][property] = struct{}{}
+		}
+	}
+
+	return deltaPage[T]{
+		values:     resp.GetValue(),
+		properties: properties,
+		nextLink:   resp.GetOdataNextLink(),
+		deltaLink:  resp.GetOdataDeltaLink(),
+	}, nil
+}
+
+// fillMissing copies the properties of src into dst which are neither set in dst nor in the payload of dst. A
+// property in the payload was updated, even if it was cleared to null.
+func fillMissing(dst, src store.BackedModel, properties map[string]struct{}) {
+	for key, value := range src.GetBackingStore().Enumerate() {
+		if _, ok := properties[key]; ok {
+			continue
+		}
+
+		if current, err := dst.GetBackingStore().Get(key); err == nil && current == nil {
+			_ = dst.GetBackingStore().Set(key, value)
+		}
+	}
+}
+
+// isDeltaTokenExpired reports whether err indicates that the delta token can no longer be used
+// and a full resync is required.
+func isDeltaTokenExpired(err error) bool {
+	var odataError *odataerrors.ODataError
+	if !errors.As(err, &odataError) {
+		return false
+	}
+
+	if odataError.ResponseStatusCode == http.StatusGone {
+		return true
+	}
+
+	if mainError := odataError.GetErrorEscaped(); mainError != nil && mainError.GetCode() != nil {
+		switch *mainError.GetCode() {
+		case "resyncRequired", "syncStateNotFound", "SyncStateNotFound", "syncStateInvalid":
+			return true
+		}
+	}
+
+	return false
+}
+
+func compareIDs(a, b *string) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	return strings.Compare(*a, *b)
+}
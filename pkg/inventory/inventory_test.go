@@ -0,0 +1,98 @@
+package inventory_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/pkg/inventory"
+	"github.com/microsoft/kiota-abstractions-go/authentication"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_Users(t *testing.T) {
+	t.Parallel()
+
+	var fullSyncs atomic.Int32
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1.0/users/delta()", r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		deltaLink := server.URL + "/v1.0/users/delta()?$deltatoken="
+
+		switch query := r.URL.Query(); {
+		case query.Get("$skiptoken") == "page2":
+			_, _ = fmt.Fprintf(w, `{"value":[{"id":"2","userPrincipalName":"bob@contoso.com"}],"@odata.deltaLink":"%s"}`, deltaLink+"first")
+		case query.Get("$deltatoken") == "first":
+			// user 1 was renamed and its user type cleared, user 2 was deleted, user 3 was added
+			_, _ = fmt.Fprintf(w, `{"value":[
+				{"id":"1","displayName":"Alice Renamed","userType":null},
+				{"id":"2","@removed":{"reason":"changed"}},
+				{"id":"3","userPrincipalName":"carol@contoso.com"}
+			],"@odata.deltaLink":"%s"}`, deltaLink+"second")
+		case query.Get("$deltatoken") == "second":
+			w.WriteHeader(http.StatusGone)
+			_, _ = io.WriteString(w, `{"error":{"code":"resyncRequired","message":"token expired"}}`)
+		default:
+			fullSyncs.Add(1)
+
+			_, _ = fmt.Fprintf(w, `{"value":[{"id":"1","userPrincipalName":"alice@contoso.com","displayName":"Alice","userType":"Guest"}],"@odata.nextLink":"%s"}`,
+				server.URL+"/v1.0/users/delta()?$skiptoken=page2")
+		}
+	}))
+	defer server.Close()
+
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(
+		&authentication.AnonymousAuthenticationProvider{}, nil, nil, server.Client(),
+	)
+	require.NoError(t, err)
+
+	adapter.SetBaseUrl(server.URL + "/v1.0")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cache := inventory.NewCache(logger, "tenant", msgraphsdk.NewGraphServiceClient(adapter), inventory.Settings{})
+
+	// initial full sync across two pages
+	users, err := cache.Users(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice@contoso.com", "bob@contoso.com"}, upns(users))
+
+	// incremental sync applies updates and deletions
+	users, err = cache.Users(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice@contoso.com", "carol@contoso.com"}, upns(users))
+	assert.Equal(t, "Alice Renamed", *users[0].GetDisplayName())
+	assert.Nil(t, users[0].GetUserType())
+
+	// expired delta token triggers a full resync
+	users, err = cache.Users(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice@contoso.com", "bob@contoso.com"}, upns(users))
+
+	assert.Equal(t, int32(2), fullSyncs.Load())
+	// 3 gauges for users (groups and devices were never synced) and 3 reasons times 3 types of full sync counters
+	assert.Equal(t, 12, testutil.CollectAndCount(cache))
+}
+
+func upns(users []models.Userable) []string {
+	result := make([]string, 0, len(users))
+
+	for _, user := range users {
+		result = append(result, *user.GetUserPrincipalName())
+	}
+
+	return result
+}
@@ -0,0 +1,165 @@
+// Package rest sends JSON requests to Microsoft APIs which are not covered by the Graph SDK, e.g. ARM,
+// the Exchange Online admin API or SharePoint.
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cloudeteer/m365-exporter/pkg/util"
+)
+
+// DefaultMaxBodySize is the default limit of response bodies.
+const DefaultMaxBodySize = 32 << 20
+
+// maxPages stops paging through a collection whose next links never end.
+const maxPages = 1000
+
+// ErrBodyTooLarge is returned for responses larger than Settings.MaxBodySize.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+type Settings struct {
+	// Service names the API in errors, see util.ServiceGraph and others.
+	Service string
+	// Header is added to every request, e.g. odata-version for SharePoint.
+	Header http.Header
+	// MaxBodySize limits response bodies, DefaultMaxBodySize if 0.
+	MaxBodySize int64
+}
+
+// Client sends JSON requests to one API. The http client is expected to authenticate requests.
+type Client struct {
+	httpClient *http.Client
+	settings   Settings
+}
+
+// page is a page of an OData collection. Graph links to the next page with @odata.nextLink, ARM with nextLink.
+type page[T any] struct {
+	Value         []T    `json:"value"`
+	ODataNextLink string `json:"@odata.nextLink"`
+	NextLink      string `json:"nextLink"`
+}
+
+func NewClient(httpClient *http.Client, settings Settings) *Client {
+	if settings.MaxBodySize <= 0 {
+		settings.MaxBodySize = DefaultMaxBodySize
+	}
+
+	return &Client{httpClient: httpClient, settings: settings}
+}
+
+// GetJSON sends a GET request to url and decodes the response into T.
+func GetJSON[T any](ctx context.Context, c *Client, url string) (T, error) {
+	var value T
+
+	err := c.do(ctx, http.MethodGet, url, nil, &value)
+
+	return value, err
+}
+
+// PostJSON sends body as JSON to url and decodes the response into T.
+func PostJSON[T any](ctx context.Context, c *Client, url string, body any) (T, error) {
+	var value T
+
+	content, err := json.Marshal(body)
+	if err != nil {
+		return value, fmt.Errorf("error encoding request body: %w", err)
+	}
+
+	err = c.do(ctx, http.MethodPost, url, content, &value)
+
+	return value, err
+}
+
+// GetAll sends a GET request to url and returns the value of all pages of the returned collection.
+func GetAll[T any](ctx context.Context, c *Client, url string) ([]T, error) {
+	return all(url, func(url string) (page[T], error) {
+		return GetJSON[page[T]](ctx, c, url)
+	})
+}
+
+// PostAll sends body as JSON to url and returns the value of all pages of the returned collection. Next pages are
+// requested by sending body again to the next link, as the Exchange Online admin API expects.
+func PostAll[T any](ctx context.Context, c *Client, url string, body any) ([]T, error) {
+	return all(url, func(url string) (page[T], error) {
+		return PostJSON[page[T]](ctx, c, url, body)
+	})
+}
+
+func all[T any](url string, get func(url string) (page[T], error)) ([]T, error) {
+	var values []T
+
+	for range maxPages {
+		page, err := get(url)
+		if err != nil {
+			return values, err
+		}
+
+		values = append(values, page.Value...)
+
+		url = page.ODataNextLink
+		if url == "" {
+			url = page.NextLink
+		}
+
+		if url == "" {
+			return values, nil
+		}
+	}
+
+	return values, fmt.Errorf("collection has more than %d pages", maxPages)
+}
+
+func (c *Client) do(ctx context.Context, method, url string, body []byte, value any) error {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	for key, values := range c.settings.Header {
+		req.Header[key] = values
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, c.settings.MaxBodySize+1))
+	_ = resp.Body.Close()
+
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if int64(len(respBody)) > c.settings.MaxBodySize {
+		return fmt.Errorf("%s %s: %w, limit is %d bytes", method, req.URL.Path, ErrBodyTooLarge, c.settings.MaxBodySize)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %w", method, req.URL.Path, util.NewAPIError(c.settings.Service, resp, respBody))
+	}
+
+	err = json.Unmarshal(respBody, value)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling response of %s %s: %w", method, req.URL.Path, err)
+	}
+
+	return nil
+}
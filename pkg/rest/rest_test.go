@@ -0,0 +1,143 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudeteer/m365-exporter/pkg/rest"
+	"github.com/cloudeteer/m365-exporter/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	ID string `json:"id"`
+}
+
+func TestGetAll(t *testing.T) {
+	t.Parallel()
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "4.0", r.Header.Get("Odata-Version"))
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+
+		switch r.URL.Query().Get("page") {
+		case "":
+			_, _ = io.WriteString(w, `{"value":[{"id":"1"}],"@odata.nextLink":"`+server.URL+`/items?page=2"}`)
+		case "2":
+			// ARM style next link
+			_, _ = io.WriteString(w, `{"value":[{"id":"2"}],"nextLink":"`+server.URL+`/items?page=3"}`)
+		default:
+			_, _ = io.WriteString(w, `{"value":[{"id":"3"}]}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := rest.NewClient(server.Client(), rest.Settings{
+		Service: util.ServiceSharePoint,
+		Header:  http.Header{"Odata-Version": {"4.0"}},
+	})
+
+	// TODO: Go 1.24: Change to t.Context()
+	items, err := rest.GetAll[item](context.Background(), client, server.URL+"/items")
+	require.NoError(t, err)
+	assert.Equal(t, []item{{ID: "1"}, {ID: "2"}, {ID: "3"}}, items)
+}
+
+func TestPostJSON(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var body map[string]string
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		_, _ = io.WriteString(w, `{"id":"`+body["name"]+`"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := rest.NewClient(server.Client(), rest.Settings{Service: util.ServiceExchange})
+
+	// TODO: Go 1.24: Change to t.Context()
+	value, err := rest.PostJSON[item](context.Background(), client, server.URL, map[string]string{"name": "gopher"})
+	require.NoError(t, err)
+	assert.Equal(t, item{ID: "gopher"}, value)
+}
+
+func TestPostAll(t *testing.T) {
+	t.Parallel()
+
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"name":"gopher"}`, string(body), "every page is requested with the body")
+
+		if r.URL.Query().Get("page") == "" {
+			_, _ = io.WriteString(w, `{"value":[{"id":"1"}],"@odata.nextLink":"`+server.URL+`/items?page=2"}`)
+
+			return
+		}
+
+		_, _ = io.WriteString(w, `{"value":[{"id":"2"}]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := rest.NewClient(server.Client(), rest.Settings{Service: util.ServiceExchange})
+
+	// TODO: Go 1.24: Change to t.Context()
+	items, err := rest.PostAll[item](context.Background(), client, server.URL+"/items", map[string]string{"name": "gopher"})
+	require.NoError(t, err)
+	assert.Equal(t, []item{{ID: "1"}, {ID: "2"}}, items)
+}
+
+func TestGetJSON_Errors(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/forbidden":
+			w.Header().Set("x-ms-request-id", "4711")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"error":{"code":"AuthorizationFailed","message":"no access"}}`)
+		case "/large":
+			_, _ = io.WriteString(w, `{"id":"`+strings.Repeat("x", 100)+`"}`)
+		default:
+			_, _ = io.WriteString(w, `not json`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := rest.NewClient(server.Client(), rest.Settings{Service: util.ServiceARM, MaxBodySize: 64})
+
+	// TODO: Go 1.24: Change to t.Context()
+	ctx := context.Background()
+
+	_, err := rest.GetJSON[item](ctx, client, server.URL+"/forbidden")
+
+	var apiError *util.APIError
+	require.ErrorAs(t, err, &apiError)
+	assert.Equal(t, util.ServiceARM, apiError.Service)
+	assert.Equal(t, "AuthorizationFailed", apiError.Code)
+	assert.Equal(t, "4711", apiError.RequestID)
+	assert.True(t, util.IsForbidden(err))
+
+	_, err = rest.GetJSON[item](ctx, client, server.URL+"/large")
+	require.ErrorIs(t, err, rest.ErrBodyTooLarge)
+
+	_, err = rest.GetJSON[item](ctx, client, server.URL+"/invalid")
+	require.ErrorContains(t, err, "error unmarshalling response of GET /invalid")
+}
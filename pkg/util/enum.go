@@ -0,0 +1,12 @@
+package util
+
+import "fmt"
+
+// EnumString returns the name of an enum value of the Graph SDK, or an empty string for values unknown to the SDK.
+func EnumString[T fmt.Stringer](value *T) string {
+	if value == nil {
+		return ""
+	}
+
+	return (*value).String()
+}
@@ -1,19 +1,250 @@
 package util
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	abstractions "github.com/microsoft/kiota-abstractions-go"
 	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
 )
 
+// Services of APIError.
+const (
+	ServiceGraph      = "graph"
+	ServiceARM        = "arm"
+	ServiceExchange   = "exchange"
+	ServiceSharePoint = "sharepoint"
+)
+
+// maxMessageLength limits messages taken from unstructured response bodies.
+const maxMessageLength = 512
+
+// requestIDHeaders are the response headers carrying the id Microsoft support asks for, in order of preference.
+var requestIDHeaders = []string{"request-id", "x-ms-request-id", "SPRequestGuid", "client-request-id"}
+
+// APIError is a failed request to a Microsoft API, either returned by the Graph SDK or read from a raw HTTP response.
+type APIError struct {
+	Service    string
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	// RetryAfter is the delay requested by the Retry-After header, 0 if it was not set.
+	RetryAfter time.Duration
+
+	err error
+}
+
+func (e *APIError) Error() string {
+	var msg strings.Builder
+
+	fmt.Fprintf(&msg, "%s: status %d", e.Service, e.StatusCode)
+
+	if e.Code != "" {
+		msg.WriteString(": " + e.Code)
+	}
+
+	if e.Message != "" {
+		msg.WriteString(": " + e.Message)
+	}
+
+	if e.RequestID != "" {
+		msg.WriteString(" (request-id " + e.RequestID + ")")
+	}
+
+	return msg.String()
+}
+
+// Unwrap returns the error of the Graph SDK, if any.
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+// GetOdataError converts errors of the Graph SDK, including wrapped ones, into an *APIError. Other errors and errors
+// which already contain an *APIError are returned unchanged.
 func GetOdataError(err error) error {
+	var apiError *APIError
+	if err == nil || errors.As(err, &apiError) {
+		return err
+	}
+
+	var sdkError abstractions.ApiErrorable
+	if !errors.As(err, &sdkError) {
+		return err
+	}
+
+	apiError = &APIError{
+		Service:    ServiceGraph,
+		StatusCode: sdkError.GetStatusCode(),
+		err:        err,
+	}
+
+	if headers := sdkError.GetResponseHeaders(); headers != nil {
+		apiError.RequestID = firstHeader(headers.Get, requestIDHeaders...)
+		apiError.RetryAfter = parseRetryAfter(firstHeader(headers.Get, "Retry-After"))
+	}
+
 	var odataError *odataerrors.ODataError
 	if errors.As(err, &odataError) {
-		if terr := odataError.GetErrorEscaped(); terr != nil {
-			return fmt.Errorf("%s: %s: %w", *terr.GetCode(), *terr.GetMessage(), err)
+		if mainError := odataError.GetErrorEscaped(); mainError != nil {
+			apiError.Code = deref(mainError.GetCode())
+
+			// the text of wrapped errors is kept, it names e.g. the failed batch request
+			if any(odataError) == any(err) {
+				apiError.Message = deref(mainError.GetMessage())
+			}
+
+			if innerError := mainError.GetInnerError(); innerError != nil && apiError.RequestID == "" {
+				apiError.RequestID = deref(innerError.GetRequestId())
+			}
 		}
 	}
 
-	return err
+	if apiError.Message == "" {
+		apiError.Message = err.Error()
+	}
+
+	return apiError
+}
+
+// NewAPIError returns the error of a failed raw HTTP request to service. body is the read response body, it is
+// parsed for the error formats of Graph, ARM, Entra ID and SharePoint.
+func NewAPIError(service string, resp *http.Response, body []byte) *APIError {
+	apiError := &APIError{
+		Service:    service,
+		StatusCode: resp.StatusCode,
+		RequestID:  firstHeader(resp.Header.Values, requestIDHeaders...),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var content struct {
+		Error json.RawMessage `json:"error"`
+		// Entra ID token errors, also returned by SharePoint
+		ErrorDescription string `json:"error_description"`
+		// SharePoint REST API errors
+		ODataError *struct {
+			Code    string `json:"code"`
+			Message struct {
+				Value string `json:"value"`
+			} `json:"message"`
+		} `json:"odata.error"`
+	}
+
+	if json.Unmarshal(body, &content) != nil {
+		apiError.Message = truncate(strings.TrimSpace(string(body)))
+
+		return apiError
+	}
+
+	var graphError struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		InnerError struct {
+			RequestID string `json:"request-id"`
+		} `json:"innerError"`
+	}
+
+	switch {
+	case content.ODataError != nil:
+		apiError.Code = content.ODataError.Code
+		apiError.Message = content.ODataError.Message.Value
+	case json.Unmarshal(content.Error, &graphError) == nil:
+		apiError.Code = graphError.Code
+		apiError.Message = graphError.Message
+
+		if apiError.RequestID == "" {
+			apiError.RequestID = graphError.InnerError.RequestID
+		}
+	default:
+		// e.g. {"error":"invalid_request","error_description":"..."}
+		_ = json.Unmarshal(content.Error, &apiError.Code)
+	}
+
+	if content.ErrorDescription != "" && apiError.Message == "" {
+		apiError.Message = content.ErrorDescription
+	}
+
+	if apiError.Code == "" && apiError.Message == "" {
+		apiError.Message = truncate(strings.TrimSpace(string(body)))
+	}
+
+	return apiError
+}
+
+// IsThrottled reports whether err is a 429, or a 503 with Retry-After, which Graph also uses for throttling.
+func IsThrottled(err error) bool {
+	var apiError *APIError
+	if !errors.As(GetOdataError(err), &apiError) {
+		return false
+	}
+
+	return apiError.StatusCode == http.StatusTooManyRequests ||
+		(apiError.StatusCode == http.StatusServiceUnavailable && apiError.RetryAfter > 0)
+}
+
+// IsForbidden reports whether err is a 403, usually caused by a missing permission or license.
+func IsForbidden(err error) bool {
+	return statusCode(err) == http.StatusForbidden
+}
+
+// IsNotFound reports whether err is a 404.
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+func statusCode(err error) int {
+	var apiError *APIError
+	if errors.As(GetOdataError(err), &apiError) {
+		return apiError.StatusCode
+	}
+
+	return 0
+}
+
+func firstHeader(get func(key string) []string, keys ...string) string {
+	for _, key := range keys {
+		if values := get(key); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+
+	return ""
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+func truncate(message string) string {
+	if len(message) > maxMessageLength {
+		return message[:maxMessageLength] + "..."
+	}
+
+	return message
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
 }
@@ -1,12 +1,17 @@
 package util
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
+	abstractions "github.com/microsoft/kiota-abstractions-go"
 	"github.com/microsoft/kiota-abstractions-go/store"
 	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_OdataErorr(t *testing.T) {
@@ -28,3 +33,155 @@ func Test_OdataErorr(t *testing.T) {
 		assert.ErrorContains(t, result, fmt.Sprintf("%s: %s", *err.GetErrorEscaped().GetCode(), *err.GetErrorEscaped().GetMessage()))
 	})
 }
+
+func newODataError(status int, code, message, requestID string) *odataerrors.ODataError {
+	mainError := odataerrors.NewMainError()
+	mainError.SetCode(&code)
+	mainError.SetMessage(&message)
+
+	innerError := odataerrors.NewInnerError()
+	innerError.SetRequestId(&requestID)
+	mainError.SetInnerError(innerError)
+
+	err := odataerrors.NewODataError()
+	err.SetErrorEscaped(mainError)
+	err.SetStatusCode(status)
+
+	return err
+}
+
+func TestGetOdataError(t *testing.T) {
+	t.Parallel()
+
+	sdkError := newODataError(http.StatusForbidden, "Authorization_RequestDenied", "Insufficient privileges", "4711")
+
+	err := GetOdataError(sdkError)
+
+	var apiError *APIError
+	require.ErrorAs(t, err, &apiError)
+	assert.Equal(t, ServiceGraph, apiError.Service)
+	assert.Equal(t, http.StatusForbidden, apiError.StatusCode)
+	assert.Equal(t, "Authorization_RequestDenied", apiError.Code)
+	assert.Equal(t, "4711", apiError.RequestID)
+	assert.EqualError(t, err, "graph: status 403: Authorization_RequestDenied: Insufficient privileges (request-id 4711)")
+	assert.ErrorIs(t, err, sdkError)
+
+	// converting again keeps the error
+	assert.Same(t, err, GetOdataError(err))
+
+	// wrapped errors keep their text
+	wrapped := GetOdataError(fmt.Errorf("request 1 failed: %w", sdkError))
+	assert.ErrorContains(t, wrapped, "Authorization_RequestDenied: request 1 failed: Insufficient privileges")
+	assert.True(t, IsForbidden(wrapped))
+
+	plain := errors.New("boom")
+	assert.Same(t, plain, GetOdataError(plain))
+	assert.NoError(t, GetOdataError(nil))
+}
+
+func TestGetOdataError_Headers(t *testing.T) {
+	t.Parallel()
+
+	sdkError := abstractions.NewApiError()
+	sdkError.SetStatusCode(http.StatusTooManyRequests)
+	sdkError.GetResponseHeaders().Add("request-id", "4711")
+	sdkError.GetResponseHeaders().Add("Retry-After", "7")
+
+	var apiError *APIError
+	require.ErrorAs(t, GetOdataError(sdkError), &apiError)
+	assert.Equal(t, "4711", apiError.RequestID)
+	assert.Equal(t, 7*time.Second, apiError.RetryAfter)
+	assert.True(t, IsThrottled(sdkError))
+}
+
+func TestNewAPIError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		body    string
+		want    APIError
+		wantErr string
+	}{
+		{
+			name:   "graph",
+			status: http.StatusForbidden,
+			header: http.Header{"Request-Id": {"4711"}},
+			body:   `{"error":{"code":"Forbidden","message":"Missing role","innerError":{"request-id":"ignored"}}}`,
+			want:   APIError{Service: ServiceGraph, StatusCode: http.StatusForbidden, Code: "Forbidden", Message: "Missing role", RequestID: "4711"},
+		},
+		{
+			name:   "graph inner request id",
+			status: http.StatusNotFound,
+			body:   `{"error":{"code":"NotFound","message":"gone","innerError":{"request-id":"4712"}}}`,
+			want:   APIError{Service: ServiceGraph, StatusCode: http.StatusNotFound, Code: "NotFound", Message: "gone", RequestID: "4712"},
+		},
+		{
+			name:   "arm",
+			status: http.StatusTooManyRequests,
+			header: http.Header{"X-Ms-Request-Id": {"4713"}, "Retry-After": {"30"}},
+			body:   `{"error":{"code":"TooManyRequests","message":"slow down"}}`,
+			want:   APIError{Service: ServiceGraph, StatusCode: http.StatusTooManyRequests, Code: "TooManyRequests", Message: "slow down", RequestID: "4713", RetryAfter: 30 * time.Second},
+		},
+		{
+			name:   "token error",
+			status: http.StatusUnauthorized,
+			body:   `{"error":"invalid_client","error_description":"AADSTS7000215: Invalid client secret"}`,
+			want:   APIError{Service: ServiceGraph, StatusCode: http.StatusUnauthorized, Code: "invalid_client", Message: "AADSTS7000215: Invalid client secret"},
+		},
+		{
+			name:   "sharepoint",
+			status: http.StatusForbidden,
+			header: http.Header{"Sprequestguid": {"4714"}},
+			body:   `{"odata.error":{"code":"-2147024891, System.UnauthorizedAccessException","message":{"lang":"en-US","value":"Access denied."}}}`,
+			want:   APIError{Service: ServiceGraph, StatusCode: http.StatusForbidden, Code: "-2147024891, System.UnauthorizedAccessException", Message: "Access denied.", RequestID: "4714"},
+		},
+		{
+			name:    "text",
+			status:  http.StatusBadGateway,
+			body:    "<html>Bad Gateway</html>\n",
+			want:    APIError{Service: ServiceGraph, StatusCode: http.StatusBadGateway, Message: "<html>Bad Gateway</html>"},
+			wantErr: "graph: status 502: <html>Bad Gateway</html>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+
+			err := NewAPIError(ServiceGraph, &http.Response{StatusCode: tt.status, Header: header}, []byte(tt.body))
+			assert.Equal(t, tt.want, *err)
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsStatus(t *testing.T) {
+	t.Parallel()
+
+	newError := func(status int, header http.Header) error {
+		if header == nil {
+			header = http.Header{}
+		}
+
+		return fmt.Errorf("failed: %w", NewAPIError(ServiceARM, &http.Response{StatusCode: status, Header: header}, nil))
+	}
+
+	assert.True(t, IsThrottled(newError(http.StatusTooManyRequests, nil)))
+	assert.True(t, IsThrottled(newError(http.StatusServiceUnavailable, http.Header{"Retry-After": {"5"}})))
+	assert.False(t, IsThrottled(newError(http.StatusServiceUnavailable, nil)))
+	assert.True(t, IsForbidden(newError(http.StatusForbidden, nil)))
+	assert.True(t, IsNotFound(newError(http.StatusNotFound, nil)))
+	assert.True(t, IsNotFound(newODataError(http.StatusNotFound, "itemNotFound", "no drive", "")))
+	assert.False(t, IsNotFound(errors.New("not found")))
+}
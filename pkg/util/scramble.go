@@ -0,0 +1,12 @@
+package util
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// ScrambleName returns the salted SHA-256 hash of a user principal name, which replaces the UPN in labels if names
+// are scrambled. All collectors use the same salt, so a user has the same hash in every collector.
+func ScrambleName(upn, salt string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(upn+"+"+salt)))
+}